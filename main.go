@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"mitosu/src/cmd"
 	"mitosu/src/data"
 	"mitosu/src/logger"
@@ -33,23 +34,19 @@ func main() {
 			{
 				Name:        "stat",
 				Description: "See stats of a server",
-				Flags: []cli.Flag{
-					&cli.BoolFlag{
-						Name:     "no-prompt",
-						Usage:    "Never prompt for passwords, all passwords must be supplied via environment variables or command flags.",
-						Required: false,
-					},
-					&cli.BoolFlag{
-						Name:     "no-pass-sudo",
-						Usage:    "Should be set if the remote user doesn't need a password for sudo.",
-						Required: false,
-					},
+				Flags: append(sshFlags(), []cli.Flag{
 					&cli.BoolFlag{
 						Name:     "json",
 						Aliases:  []string{"j"},
 						Usage:    "Output in JSON for parsing by another tool.",
 						Required: false,
 					},
+					&cli.StringFlag{
+						Name:     "format",
+						Usage:    "Output format, text, json or ndjson. ndjson writes a compact JSON report per host on every poll, one per line, without taking over the terminal.",
+						Value:    "text",
+						Required: false,
+					},
 					&cli.BoolFlag{
 						Name:     "no-color",
 						Aliases:  []string{"n"},
@@ -63,83 +60,124 @@ func main() {
 						Value:    0,
 						Required: false,
 					},
-					&cli.BoolFlag{
-						Name:     "with-root",
-						Aliases:  []string{"R"},
-						Usage:    "Elevate the remote shell using sudo.",
-						Required: false,
-					},
-					&cli.StringFlag{
-						Name:     "config",
-						Aliases:  []string{"c"},
-						Usage:    "The SSH config file path.",
-						Value:    "~/.ssh/config",
-						Required: false,
-					},
-					&cli.StringFlag{
-						Name:     "alias",
-						Aliases:  []string{"a"},
-						Usage:    "The SSH config host alias.",
-						Required: false,
-					},
-					&cli.StringFlag{
-						Name:     "host",
-						Aliases:  []string{"H"},
-						Usage:    "The remote host (IP address or domain).",
-						Required: false,
-					},
-					&cli.IntFlag{
-						Name:     "port",
-						Aliases:  []string{"p"},
-						Usage:    "The remote SSH port.",
-						Value:    22,
-						Required: false,
+				}...),
+				Commands: []*cli.Command{
+					{
+						Name:        "all",
+						Description: "See all stats",
+						Action: func(ctx context.Context, c *cli.Command) error {
+							return cmd.CmdStat(ctx, c, func() []data.SystemStat {
+								return []data.SystemStat{
+									&data.InventorySystemStat{},
+									&data.ProcInfoSystemStat{},
+									&data.DockerSystemStat{},
+									&data.FSSystemStat{},
+									&data.DiskIOSystemStat{},
+									&data.NetIntfSystemStat{},
+									&data.SystemdSystemStat{},
+								}
+							})
+						},
 					},
-					&cli.StringFlag{
-						Name:     "user",
-						Aliases:  []string{"u"},
-						Usage:    "The user to SSH as.",
-						Value:    "root",
-						Required: false,
+					{
+						Name:        "docker",
+						Aliases:     []string{"containers"},
+						Description: "See the containers of Docker, Podman, nerdctl or crictl",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:     "disk",
+								Usage:    "See the disk used by Docker images, containers, volumes and build cache instead.",
+								Required: false,
+							},
+							&cli.UintFlag{
+								Name:     "top",
+								Usage:    "The number of the largest images and volumes to show with --disk.",
+								Value:    data.DefaultDockerDiskLimit,
+								Required: false,
+							},
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							return cmd.CmdStat(ctx, c, func() []data.SystemStat {
+
+								if c.Bool("disk") {
+									return []data.SystemStat{
+										&data.DockerDiskSystemStat{Limit: int(c.Uint("top"))},
+									}
+								}
+
+								return []data.SystemStat{
+									&data.DockerSystemStat{},
+								}
+							})
+						},
 					},
-					&cli.StringFlag{
-						Name:     "user-pass",
-						Usage:    "The remote user password.",
-						Sources:  cli.EnvVars("MITOSU_USER_PASSWORD"),
-						Required: false,
+					{
+						Name:        "procs",
+						Description: "See the top processes by CPU and memory",
+						Flags: []cli.Flag{
+							&cli.UintFlag{
+								Name:     "top",
+								Usage:    "The number of processes to show.",
+								Value:    data.DefaultProcessLimit,
+								Required: false,
+							},
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							return cmd.CmdStat(ctx, c, func() []data.SystemStat {
+								return []data.SystemStat{
+									&data.ProcessSystemStat{Limit: int(c.Uint("top"))},
+								}
+							})
+						},
 					},
-					&cli.StringFlag{
-						Name:     "key",
-						Aliases:  []string{"i"},
-						Usage:    "The SSH private key file path.",
-						Required: false,
+					{
+						Name:        "disk",
+						Description: "See disk I/O throughput, utilization and latency",
+						Action: func(ctx context.Context, c *cli.Command) error {
+							return cmd.CmdStat(ctx, c, func() []data.SystemStat {
+								return []data.SystemStat{
+									&data.DiskIOSystemStat{},
+								}
+							})
+						},
 					},
-					&cli.StringFlag{
-						Name:     "key-pass",
-						Usage:    "The SSH private key password.",
-						Sources:  cli.EnvVars("MITOSU_KEY_PASSWORD"),
-						Required: false,
+					{
+						Name:        "systemd",
+						Description: "See failed systemd units, and the state of chosen units",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:     "units",
+								Usage:    "A unit to show the state, restarts, memory and CPU of, like nginx.service. Can be given many times.",
+								Required: false,
+							},
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							return cmd.CmdStat(ctx, c, func() []data.SystemStat {
+								return []data.SystemStat{
+									&data.SystemdSystemStat{Units: c.StringSlice("units")},
+								}
+							})
+						},
 					},
-				},
-				Commands: []*cli.Command{
 					{
-						Name:        "all",
-						Description: "See all stats",
+						Name:        "sockets",
+						Description: "See listening ports and TCP connections by state, the processes are only known with --with-root",
 						Action: func(ctx context.Context, c *cli.Command) error {
-							return cmd.CmdStat(ctx, c, []data.SystemStat{
-								&data.ProcInfoSystemStat{},
-								&data.DockerSystemStat{},
-								&data.FSSystemStat{},
-								&data.NetIntfSystemStat{},
+							return cmd.CmdStat(ctx, c, func() []data.SystemStat {
+								return []data.SystemStat{
+									&data.SocketsSystemStat{},
+								}
 							})
 						},
 					},
 					{
-						Name:        "docker",
-						Description: "See Docker stats",
+						Name:        "sensors",
+						Description: "See hardware temperatures and fan speeds",
 						Action: func(ctx context.Context, c *cli.Command) error {
-							return cmd.CmdStat(ctx, c, []data.SystemStat{
-								&data.DockerSystemStat{},
+							return cmd.CmdStat(ctx, c, func() []data.SystemStat {
+								return []data.SystemStat{
+									&data.SensorsSystemStat{},
+								}
 							})
 						},
 					},
@@ -147,13 +185,85 @@ func main() {
 						Name:        "fs",
 						Description: "See file system stats",
 						Action: func(ctx context.Context, c *cli.Command) error {
-							return cmd.CmdStat(ctx, c, []data.SystemStat{
-								&data.FSSystemStat{},
+							return cmd.CmdStat(ctx, c, func() []data.SystemStat {
+								return []data.SystemStat{
+									&data.FSSystemStat{},
+								}
 							})
 						},
 					},
 				},
 			},
+			{
+				Name:        "serve",
+				Description: "Serve the stats of one or more servers as Prometheus metrics on /metrics",
+				Flags: append(sshFlags(), []cli.Flag{
+					&cli.StringFlag{
+						Name:     "listen",
+						Aliases:  []string{"l"},
+						Usage:    "The address to serve metrics on.",
+						Value:    ":9817",
+						Required: false,
+					},
+					&cli.UintFlag{
+						Name:     "interval",
+						Usage:    "Collect every n seconds in the background. When 0 stats are collected on every scrape.",
+						Value:    0,
+						Required: false,
+					},
+				}...),
+				Action: func(ctx context.Context, c *cli.Command) error {
+					return cmd.CmdServe(ctx, c, func() []data.SystemStat {
+						return []data.SystemStat{
+							&data.InventorySystemStat{},
+							&data.ProcInfoSystemStat{},
+							&data.DockerSystemStat{},
+							&data.FSSystemStat{},
+							&data.NetIntfSystemStat{},
+						}
+					})
+				},
+			},
+			{
+				Name:        "inventory",
+				Description: "See the OS, kernel, CPU, memory and virtualization of servers, as text, JSON or CSV",
+				Flags: append(sshFlags(), []cli.Flag{
+					&cli.StringFlag{
+						Name:     "format",
+						Usage:    "Output format, text, json or csv. csv writes a row per host for a spreadsheet.",
+						Value:    "text",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "no-color",
+						Aliases:  []string{"n"},
+						Usage:    "When set, don't show any color or use ANSI Escape Codes.",
+						Required: false,
+					},
+				}...),
+				Action: cmd.CmdInventory,
+			},
+			{
+				Name:        "check",
+				Description: "Check stats against thresholds like a Nagios plugin, exiting 0 for OK, 1 for WARNING, 2 for CRITICAL or 3 for UNKNOWN",
+				Flags: append(sshFlags(), []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "warn",
+						Usage:    "A threshold which is a warning when true, like fs.used_pct>80. Can be given many times.",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "crit",
+						Usage:    "A threshold which is critical when true, like load1>8 or docker.container.missing=api. Can be given many times.",
+						Required: false,
+					},
+				}...),
+				OnUsageError: func(ctx context.Context, c *cli.Command, err error, isSubcommand bool) error {
+					fmt.Printf("MITOSU UNKNOWN - %s\n", err)
+					return cli.Exit("", 3)
+				},
+				Action: cmd.CmdCheck,
+			},
 		},
 	}
 
@@ -162,3 +272,118 @@ func main() {
 	}
 
 }
+
+// sshFlags are the flags for choosing and connecting to the remote hosts, shared by every command which connects
+func sshFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:     "local",
+			Usage:    "Monitor the machine mitosu runs on by running the commands locally, without SSH.",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "docker-exec",
+			Usage:    "Run the commands inside this running container with docker exec, instead of over SSH.",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "kubectl-exec",
+			Usage:    "Run the commands inside this pod with kubectl exec, instead of over SSH. Given as namespace/pod, namespace/pod/container or pod.",
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     "no-prompt",
+			Usage:    "Never prompt for passwords, all passwords must be supplied via environment variables or command flags.",
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     "no-pass-sudo",
+			Usage:    "Should be set if the remote user doesn't need a password for sudo.",
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     "with-root",
+			Aliases:  []string{"R"},
+			Usage:    "Elevate the remote shell using sudo.",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "config",
+			Aliases:  []string{"c"},
+			Usage:    "The SSH config file path.",
+			Value:    "~/.ssh/config",
+			Required: false,
+		},
+		&cli.StringSliceFlag{
+			Name:     "alias",
+			Aliases:  []string{"a"},
+			Usage:    "The SSH config host alias. Can be given multiple times, or as a pattern like 'db*' to match hosts in the SSH config.",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "hosts-file",
+			Usage:    "A file with one SSH config host alias or host per line.",
+			Required: false,
+		},
+		&cli.UintFlag{
+			Name:     "parallel",
+			Usage:    "The number of hosts to connect to at once.",
+			Value:    8,
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "host",
+			Aliases:  []string{"H"},
+			Usage:    "The remote host (IP address or domain).",
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     "port",
+			Aliases:  []string{"p"},
+			Usage:    "The remote SSH port.",
+			Value:    22,
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "user",
+			Aliases:  []string{"u"},
+			Usage:    "The user to SSH as.",
+			Value:    "root",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "user-pass",
+			Usage:    "The remote user password.",
+			Sources:  cli.EnvVars("MITOSU_USER_PASSWORD"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "key",
+			Aliases:  []string{"i"},
+			Usage:    "The SSH private key file path.",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "key-pass",
+			Usage:    "The SSH private key password.",
+			Sources:  cli.EnvVars("MITOSU_KEY_PASSWORD"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "jump",
+			Aliases:  []string{"J"},
+			Usage:    "Connect through these jump hosts, a comma separated list of [user@]host[:port] like ProxyJump in the SSH config.",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "strict-host-key-checking",
+			Usage:    "How to handle unknown host keys: yes, accept-new, no or ask. Defaults to the StrictHostKeyChecking value of the SSH config, or ask.",
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     "insecure-ignore-host-key",
+			Usage:    "Do not verify the remote host key at all. Only use this for throwaway lab machines.",
+			Required: false,
+		},
+	}
+}
@@ -0,0 +1,186 @@
+package check
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Result is a threshold which was broken, or a host which could not be checked
+type Result struct {
+	Status  Status
+	Message string
+}
+
+// Evaluate checks every value against the thresholds, returning only the broken thresholds
+func Evaluate(values []Value, thresholds []Threshold) []Result {
+
+	results := make([]Result, 0)
+
+	for _, t := range thresholds {
+
+		if missing, ok := missingMetrics[t.Metric]; ok {
+
+			found := false
+			for _, v := range values {
+				if v.Metric == missing.metric && v.Text == t.Value {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				results = append(results, Result{Status: t.Level, Message: fmt.Sprintf(missing.message, t.Value)})
+			}
+			continue
+		}
+
+		found := false
+
+		for _, v := range values {
+
+			if v.Metric != t.Metric {
+				continue
+			}
+			found = true
+
+			if t.Matches(v) {
+				results = append(results, Result{
+					Status:  t.Level,
+					Message: fmt.Sprintf("%s=%s%s (%s%s)", v.Label(), formatNumber(v.Number), metrics[v.Metric].uom, t.Op, t.Value),
+				})
+			}
+		}
+
+		if !found {
+			results = append(results, Result{Status: StatusUnknown, Message: fmt.Sprintf("no value for %s", t.Metric)})
+		}
+	}
+
+	return results
+}
+
+// Overall is the worst status of the results, or OK when there are none
+func Overall(results []Result) Status {
+
+	status := StatusOK
+
+	for _, r := range results {
+		status = Worse(status, r.Status)
+	}
+
+	return status
+}
+
+// Output formats the single line Nagios plugin output like
+// 'MITOSU CRITICAL - load1=9.1 (>8) | load1=9.1;4;8'
+func Output(results []Result, values []Value, thresholds []Threshold) string {
+
+	status := Overall(results)
+
+	var b strings.Builder
+
+	b.WriteString("MITOSU ")
+	b.WriteString(status.String())
+	b.WriteString(" - ")
+
+	if len(results) == 0 {
+		fmt.Fprintf(&b, "all %d thresholds passed", len(thresholds))
+	} else {
+
+		messages := make([]string, 0, len(results))
+
+		// the worst problems first
+		for _, level := range []Status{StatusCritical, StatusWarning, StatusUnknown} {
+			for _, r := range results {
+				if r.Status == level {
+					messages = append(messages, r.Message)
+				}
+			}
+		}
+
+		b.WriteString(strings.Join(messages, ", "))
+	}
+
+	if perf := perfdata(values, thresholds); perf != "" {
+		b.WriteString(" | ")
+		b.WriteString(perf)
+	}
+
+	return b.String()
+}
+
+// perfdata formats the values of the metrics in the thresholds like 'label'=value[UOM];[warn];[crit];[min];[max]
+func perfdata(values []Value, thresholds []Threshold) string {
+
+	parts := make([]string, 0)
+
+	for _, v := range values {
+
+		m, ok := metrics[v.Metric]
+
+		if !ok || m.text {
+			continue
+		}
+
+		warn, crit, used := "", "", false
+
+		for _, t := range thresholds {
+
+			if t.Metric != v.Metric {
+				continue
+			}
+			used = true
+
+			if t.Level == StatusWarning && warn == "" {
+				warn = perfRange(t)
+			} else if t.Level == StatusCritical && crit == "" {
+				crit = perfRange(t)
+			}
+		}
+
+		if !used {
+			continue
+		}
+
+		min, max := "", ""
+		if m.uom == "%" {
+			min, max = "0", "100"
+		}
+
+		label := v.Label()
+
+		if strings.ContainsAny(label, " '=") {
+			label = "'" + strings.ReplaceAll(label, "'", "''") + "'"
+		}
+
+		part := fmt.Sprintf("%s=%s%s;%s;%s;%s;%s", label, formatNumber(v.Number), m.uom, warn, crit, min, max)
+		parts = append(parts, strings.TrimRight(part, ";"))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// perfRange is the Nagios range for a threshold, a plain number alerts above it and 'n:' alerts below n
+func perfRange(t Threshold) string {
+
+	if !t.IsNumber {
+		return ""
+	}
+
+	n := formatNumber(t.Number)
+
+	switch t.Op {
+	case ">", ">=":
+		return n
+	case "<", "<=":
+		return n + ":"
+	}
+
+	return ""
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(math.Round(n*100)/100, 'f', -1, 64)
+}
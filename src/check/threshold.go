@@ -0,0 +1,175 @@
+package check
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Status is a Nagios plugin status, the value is the exit code
+type Status int
+
+var (
+	StatusOK       Status = 0
+	StatusWarning  Status = 1
+	StatusCritical Status = 2
+	StatusUnknown  Status = 3
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "OK"
+	case StatusWarning:
+		return "WARNING"
+	case StatusCritical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// Worse returns the more severe status, critical is worse than warning which is worse than unknown
+func Worse(a, b Status) Status {
+
+	rank := func(s Status) int {
+		switch s {
+		case StatusCritical:
+			return 3
+		case StatusWarning:
+			return 2
+		case StatusUnknown:
+			return 1
+		}
+		return 0
+	}
+
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+// ops are checked in order, so the two character ones come first
+var ops = []string{">=", "<=", "!=", ">", "<", "="}
+
+// Threshold is a condition like 'load1>8' which raises Level when it is true
+type Threshold struct {
+	Expr   string
+	Metric string
+	Op     string
+	Value  string
+	Number float64
+
+	// IsNumber is false for values which are compared as text like a container name
+	IsNumber bool
+	Level    Status
+}
+
+// ParseThreshold parses an expression like 'fs.used_pct>80' or 'docker.container.missing=api'
+func ParseThreshold(expr string, level Status) (Threshold, error) {
+
+	t := Threshold{Expr: expr, Level: level}
+
+	i := strings.IndexAny(expr, "<>=!")
+
+	if i <= 0 {
+		return t, fmt.Errorf("Invalid threshold '%s', expected a metric, an operator and a value like load1>8", expr)
+	}
+
+	for _, op := range ops {
+		if strings.HasPrefix(expr[i:], op) {
+			t.Op = op
+			break
+		}
+	}
+
+	if t.Op == "" {
+		return t, fmt.Errorf("Invalid operator in threshold '%s'", expr)
+	}
+
+	t.Metric = strings.TrimSpace(expr[:i])
+	t.Value = strings.TrimSpace(expr[i+len(t.Op):])
+
+	metric, ok := metrics[t.Metric]
+
+	if !ok {
+		return t, fmt.Errorf("Unknown metric '%s' in threshold '%s', expected one of %s", t.Metric, expr, strings.Join(MetricNames(), ", "))
+	}
+
+	if t.Value == "" {
+		return t, fmt.Errorf("Missing value in threshold '%s'", expr)
+	}
+
+	if metric.text {
+
+		if t.Op != "=" {
+			return t, fmt.Errorf("Threshold '%s' can only use =", expr)
+		}
+
+		return t, nil
+	}
+
+	n, err := parseNumber(t.Value)
+
+	if err != nil {
+		return t, fmt.Errorf("Invalid number in threshold '%s': %w", expr, err)
+	}
+
+	t.Number = n
+	t.IsNumber = true
+
+	return t, nil
+}
+
+// Matches returns true when the value breaks the threshold
+func (t Threshold) Matches(v Value) bool {
+
+	if !t.IsNumber {
+		return v.Text == t.Value
+	}
+
+	switch t.Op {
+	case ">":
+		return v.Number > t.Number
+	case ">=":
+		return v.Number >= t.Number
+	case "<":
+		return v.Number < t.Number
+	case "<=":
+		return v.Number <= t.Number
+	case "=":
+		return v.Number == t.Number
+	case "!=":
+		return v.Number != t.Number
+	}
+
+	return false
+}
+
+// parseNumber parses numbers like '80', '80%' or sizes like '10G' which are powers of 1024
+func parseNumber(s string) (float64, error) {
+
+	s = strings.TrimSuffix(s, "%")
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "iB"), "B")
+
+	multiplier := 1.0
+
+	if n := len(s); n > 0 {
+
+		if i := strings.IndexByte("KMGTP", strings.ToUpper(s[n-1:])[0]); i != -1 {
+
+			for range i + 1 {
+				multiplier *= 1024
+			}
+			s = s[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n * multiplier, nil
+}
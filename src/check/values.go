@@ -0,0 +1,233 @@
+package check
+
+import (
+	"mitosu/src/data"
+	"sort"
+	"strconv"
+)
+
+type metric struct {
+	stat string // the Name of the collector which measures it
+	uom  string // the Nagios unit of measurement
+	text bool   // compared as text instead of a number
+}
+
+// metrics are every metric which can be used in a threshold
+var metrics = map[string]metric{
+	"load1":         {stat: "system"},
+	"load5":         {stat: "system"},
+	"load15":        {stat: "system"},
+	"uptime":        {stat: "system", uom: "s"},
+	"procs.running": {stat: "system"},
+	"procs.total":   {stat: "system"},
+	"mem.used_pct":  {stat: "system", uom: "%"},
+	"mem.available": {stat: "system", uom: "B"},
+	"swap.used_pct": {stat: "system", uom: "%"},
+
+	// the share of time stalled over the last minute
+	"psi.cpu.some":    {stat: "system", uom: "%"},
+	"psi.memory.some": {stat: "system", uom: "%"},
+	"psi.memory.full": {stat: "system", uom: "%"},
+	"psi.io.some":     {stat: "system", uom: "%"},
+	"psi.io.full":     {stat: "system", uom: "%"},
+
+	"fs.used_pct": {stat: "filesystems", uom: "%"},
+	"fs.free":     {stat: "filesystems", uom: "B"},
+
+	"sensor.temp": {stat: "sensors"},
+	"sensor.fan":  {stat: "sensors"},
+
+	"systemd.failed": {stat: "systemd"},
+
+	"tcp.established":        {stat: "sockets"},
+	"tcp.time_wait":          {stat: "sockets"},
+	"tcp.close_wait":         {stat: "sockets"},
+	"tcp.ephemeral_used_pct": {stat: "sockets", uom: "%"},
+	"port.missing":           {stat: "sockets", text: true},
+
+	"docker.container.cpu_pct": {stat: "docker", uom: "%"},
+	"docker.container.mem_pct": {stat: "docker", uom: "%"},
+	"docker.container.missing": {stat: "docker", text: true},
+}
+
+// containerName is not a metric, it is the name of every running container to find missing ones
+const containerName = "docker.container.name"
+
+// listeningPort is not a metric, it is every listening port like 443 and tcp/443 to find missing ones
+const listeningPort = "port.listening"
+
+// missingMetrics are the text metrics which are true when no value of another metric is the given text
+var missingMetrics = map[string]struct {
+	metric  string
+	message string
+}{
+	"docker.container.missing": {containerName, "container %s is not running"},
+	"port.missing":             {listeningPort, "nothing is listening on port %s"},
+}
+
+func MetricNames() []string {
+
+	names := make([]string, 0, len(metrics))
+
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Value is a single measured value, like the used percent of one filesystem which is the Instance
+type Value struct {
+	Metric   string
+	Instance string
+	Number   float64
+	Text     string
+}
+
+// Label is the metric with its instance, like 'fs.used_pct /var'
+func (v Value) Label() string {
+
+	if v.Instance == "" {
+		return v.Metric
+	}
+
+	return v.Metric + " " + v.Instance
+}
+
+// NewStats creates only the collectors needed for the thresholds
+func NewStats(thresholds []Threshold) []data.SystemStat {
+
+	needed := make(map[string]bool)
+
+	for _, t := range thresholds {
+		needed[metrics[t.Metric].stat] = true
+	}
+
+	stats := make([]data.SystemStat, 0, len(needed))
+
+	for _, stat := range []data.SystemStat{&data.ProcInfoSystemStat{}, &data.FSSystemStat{}, &data.DockerSystemStat{}, &data.SensorsSystemStat{}, &data.SystemdSystemStat{}, &data.SocketsSystemStat{}} {
+
+		if needed[stat.Name()] {
+			stats = append(stats, stat)
+		}
+	}
+
+	return stats
+}
+
+// Values gets the value of every metric from the collected stats
+func Values(stats []data.SystemStat) []Value {
+
+	values := make([]Value, 0)
+
+	add := func(metric, instance string, n float64) {
+		values = append(values, Value{Metric: metric, Instance: instance, Number: n})
+	}
+
+	for _, stat := range stats {
+
+		switch v := stat.(type) {
+
+		case *data.ProcInfoSystemStat:
+
+			add("load1", "", v.Load1)
+			add("load5", "", v.Load5)
+			add("load15", "", v.Load15)
+			add("uptime", "", v.UptimeSeconds)
+			add("procs.running", "", float64(v.RunningProcs))
+			add("procs.total", "", float64(v.TotalProcs))
+
+			add("mem.available", "", float64(v.MemAvailable))
+			add("swap.used_pct", "", float64(v.SwapUsedPerc))
+
+			if v.MemTotal > 0 {
+				add("mem.used_pct", "", float64(v.MemUsedPerc))
+			}
+
+			// missing when the kernel has no pressure stall information, so thresholds on them are unknown
+			if p := v.Pressure.CPU; p != nil {
+				add("psi.cpu.some", "", float64(p.Some.Avg60))
+			}
+
+			if p := v.Pressure.Memory; p != nil {
+				add("psi.memory.some", "", float64(p.Some.Avg60))
+				add("psi.memory.full", "", float64(p.Full.Avg60))
+			}
+
+			if p := v.Pressure.IO; p != nil {
+				add("psi.io.some", "", float64(p.Some.Avg60))
+				add("psi.io.full", "", float64(p.Full.Avg60))
+			}
+
+		case *data.FSSystemStat:
+
+			for _, fs := range v.FSInfos {
+
+				// tmpfs and the like are expected to be full
+				if fs.Type != data.FS_Local && fs.Type != data.FS_Net {
+					continue
+				}
+
+				if fs.Used+fs.Free > 0 {
+					add("fs.used_pct", fs.MountPoint, 100*float64(fs.Used)/float64(fs.Used+fs.Free))
+				}
+				add("fs.free", fs.MountPoint, float64(fs.Free))
+			}
+
+		case *data.SensorsSystemStat:
+
+			for _, sensor := range v.Sensors {
+
+				metric := "sensor.temp"
+				if sensor.Kind == "fan" {
+					metric = "sensor.fan"
+				}
+
+				add(metric, sensor.Chip+" "+sensor.Label, sensor.Value)
+			}
+
+		case *data.SystemdSystemStat:
+
+			// missing when the host does not run systemd, so thresholds on it are unknown
+			if v.Running {
+				add("systemd.failed", "", float64(len(v.Failed)))
+			}
+
+		case *data.SocketsSystemStat:
+
+			if v.Source == "" {
+				break
+			}
+
+			add("tcp.established", "", float64(v.TCPStates["ESTABLISHED"]))
+			add("tcp.time_wait", "", float64(v.TCPStates["TIME_WAIT"]))
+			add("tcp.close_wait", "", float64(v.TCPStates["CLOSE_WAIT"]))
+
+			if v.EphemeralPorts > 0 {
+				add("tcp.ephemeral_used_pct", "", float64(v.EphemeralUsedPerc()))
+			}
+
+			for _, socket := range v.Listening {
+				port := strconv.Itoa(socket.Port)
+				values = append(values, Value{Metric: listeningPort, Text: port}, Value{Metric: listeningPort, Text: socket.Protocol + "/" + port})
+			}
+
+		case *data.DockerSystemStat:
+
+			for _, ct := range v.DockerContainers {
+
+				// stopped containers are listed too, but count as missing
+				if !ct.Running() {
+					continue
+				}
+
+				add("docker.container.cpu_pct", ct.Name, float64(ct.CPU))
+				add("docker.container.mem_pct", ct.Name, float64(ct.MemPerc))
+				values = append(values, Value{Metric: containerName, Text: ct.Name})
+			}
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"mitosu/src/check"
+	"mitosu/src/data"
+	"mitosu/src/shell"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// CmdCheck is a Nagios plugin, it prints a single status line with perfdata and exits with the status
+func CmdCheck(ctx context.Context, c *cli.Command) error {
+
+	warn := c.Value("warn").([]string)
+	crit := c.Value("crit").([]string)
+	parallel := c.Value("parallel").(uint)
+	withRoot := c.Value("with-root").(bool)
+
+	log.Debug().
+		Strs("warn", warn).
+		Strs("crit", crit).
+		Strs("alias", c.Value("alias").([]string)).
+		Str("host", c.Value("host").(string)).
+		Msg("About to run check")
+
+	thresholds := make([]check.Threshold, 0, len(warn)+len(crit))
+
+	for _, levelExprs := range []struct {
+		level check.Status
+		exprs []string
+	}{
+		{check.StatusWarning, warn},
+		{check.StatusCritical, crit},
+	} {
+		for _, expr := range levelExprs.exprs {
+
+			t, err := check.ParseThreshold(expr, levelExprs.level)
+
+			if err != nil {
+				return unknown(err)
+			}
+
+			thresholds = append(thresholds, t)
+		}
+	}
+
+	if len(thresholds) == 0 {
+		return unknown(fmt.Errorf("No thresholds given, use --warn or --crit"))
+	}
+
+	targets, err := getTargets(c, func() []data.SystemStat { return check.NewStats(thresholds) })
+
+	if err != nil {
+		return unknown(err)
+	}
+
+	connectTargets(targets, int(parallel))
+	defer closeTargets(targets)
+
+	collectTargets(targets, int(parallel), withRoot, shell.PosixShell{})
+
+	results := make([]check.Result, 0)
+	values := make([]check.Value, 0)
+
+	for _, t := range targets {
+
+		if t.Err != nil {
+			results = append(results, check.Result{Status: check.StatusUnknown, Message: fmt.Sprintf("%s: %s", t.Name, t.Err)})
+			continue
+		}
+
+		hostValues := check.Values(t.Stats)
+		hostResults := check.Evaluate(hostValues, thresholds)
+
+		// with several hosts every value and problem says which host it is from
+		if len(targets) > 1 {
+
+			for i := range hostValues {
+				hostValues[i].Instance = strings.TrimSpace(t.Name + " " + hostValues[i].Instance)
+			}
+
+			for i := range hostResults {
+				hostResults[i].Message = t.Name + ": " + hostResults[i].Message
+			}
+		}
+
+		values = append(values, hostValues...)
+		results = append(results, hostResults...)
+	}
+
+	fmt.Println(check.Output(results, values, thresholds))
+
+	if status := check.Overall(results); status != check.StatusOK {
+		return cli.Exit("", int(status))
+	}
+
+	return nil
+}
+
+// unknown prints why the check could not run and exits with the UNKNOWN status
+func unknown(err error) error {
+
+	fmt.Printf("MITOSU %s - %s\n", check.StatusUnknown, err)
+
+	return cli.Exit("", int(check.StatusUnknown))
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"mitosu/src/data"
+	cf "mitosu/src/display"
+	"mitosu/src/shell"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// CmdInventory prints the OS, kernel and hardware of every host, as text, JSON or a CSV row per host
+func CmdInventory(ctx context.Context, c *cli.Command) error {
+
+	format := c.Value("format").(string)
+	noColor := c.Value("no-color").(bool)
+	parallel := c.Value("parallel").(uint)
+	withRoot := c.Value("with-root").(bool)
+
+	log.Debug().
+		Str("format", format).
+		Uint("parallel", parallel).
+		Bool("with-root", withRoot).
+		Strs("alias", c.Value("alias").([]string)).
+		Str("hosts-file", c.Value("hosts-file").(string)).
+		Str("host", c.Value("host").(string)).
+		Msg("About to run inventory")
+
+	switch format {
+	case "text", "json", "csv":
+	default:
+		return fmt.Errorf("Unknown format '%s', expected text, json or csv", format)
+	}
+
+	cf.SetColorEnabled(!noColor && format == "text" && cf.SupportsANSI())
+
+	targets, err := getTargets(c, func() []data.SystemStat {
+		return []data.SystemStat{&data.InventorySystemStat{}}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	connectTargets(targets, int(parallel))
+	defer closeTargets(targets)
+
+	collectTargets(targets, int(parallel), withRoot, shell.PosixShell{})
+
+	if format == "csv" {
+		err = writeInventoryCSV(targets)
+	} else {
+		printTargets(format == "json", &cf.VirtualTerm{}, targets)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(targets) == 1 && targets[0].Err != nil {
+		return targets[0].Err
+	}
+
+	if !slices.ContainsFunc(targets, func(t *target) bool { return t.Err == nil }) {
+		return fmt.Errorf("Could not connect to any host")
+	}
+
+	return nil
+}
+
+// inventoryColumns are the CSV header
+var inventoryColumns = []string{
+	"host", "error", "hostname", "os_name", "os_id", "os_version", "kernel", "kernel_version", "arch",
+	"cpu_model", "cpu_sockets", "cpu_cores", "cpu_threads", "mem_total", "virtualization", "vendor", "product",
+	"boot_time", "timezone", "utc_offset",
+}
+
+// writeInventoryCSV writes a row per host, a host which failed only has the error
+func writeInventoryCSV(targets []*target) error {
+
+	w := csv.NewWriter(os.Stdout)
+
+	if err := w.Write(inventoryColumns); err != nil {
+		return err
+	}
+
+	for _, t := range targets {
+
+		row := make([]string, len(inventoryColumns))
+		row[0] = t.Name
+
+		if t.Err != nil {
+			row[1] = t.Err.Error()
+		}
+
+		for _, stat := range t.Stats {
+
+			inv, ok := stat.(*data.InventorySystemStat)
+
+			if !ok || t.Err != nil {
+				continue
+			}
+
+			bootTime := ""
+			if !inv.BootTime.IsZero() {
+				bootTime = inv.BootTime.Format(time.RFC3339)
+			}
+
+			copy(row[2:], []string{
+				inv.Hostname, inv.OSName, inv.OSID, inv.OSVersion, inv.Kernel, inv.KernelVersion, inv.Arch,
+				inv.CPUModel, strconv.Itoa(inv.CPUSockets), strconv.Itoa(inv.CPUCores), strconv.Itoa(inv.CPUThreads),
+				strconv.FormatUint(inv.MemTotal, 10), inv.Virtualization, inv.Vendor, inv.Product,
+				bootTime, inv.Timezone, inv.UTCOffset,
+			})
+		}
+
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
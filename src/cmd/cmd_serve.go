@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mitosu/src/data"
+	"mitosu/src/metrics"
+	"mitosu/src/shell"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// exporter collects stats from every target and renders them as Prometheus metrics
+type exporter struct {
+	targets  []*target
+	parallel int
+	withRoot bool
+	sh       shell.Shell
+
+	mu       sync.Mutex
+	snapshot []byte
+}
+
+func CmdServe(ctx context.Context, c *cli.Command, newStats func() []data.SystemStat) error {
+
+	listen := c.Value("listen").(string)
+	interval := c.Value("interval").(uint)
+	parallel := c.Value("parallel").(uint)
+	withRoot := c.Value("with-root").(bool)
+
+	log.Debug().
+		Str("listen", listen).
+		Uint("interval", interval).
+		Uint("parallel", parallel).
+		Bool("with-root", withRoot).
+		Strs("alias", c.Value("alias").([]string)).
+		Str("hosts-file", c.Value("hosts-file").(string)).
+		Str("host", c.Value("host").(string)).
+		Msg("About to serve metrics")
+
+	targets, err := getTargets(c, newStats)
+
+	if err != nil {
+		return err
+	}
+
+	connectTargets(targets, int(parallel))
+	defer closeTargets(targets)
+
+	for _, t := range targets {
+
+		if t.Err != nil {
+			log.Warn().Err(t.Err).Str("host", t.Name).Msg("Could not connect, will retry on every collection")
+		}
+
+		// any password has been asked for already, nobody is around to answer a prompt while serving
+		if t.Client != nil {
+			t.Client.Passwords.CanPrompt = false
+			t.Client.KeepShell = true
+		}
+	}
+
+	e := &exporter{
+		targets:  targets,
+		parallel: int(parallel),
+		withRoot: withRoot,
+		sh:       shell.PosixShell{},
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if interval > 0 {
+
+		e.collect()
+
+		go func() {
+
+			ticker := time.NewTicker(time.Duration(interval) * time.Second)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					e.collect()
+				}
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+
+		if interval == 0 {
+			e.collect()
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(e.getSnapshot())
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprintln(w, `<html><head><title>mitosu</title></head><body><h1>mitosu</h1><p><a href="/metrics">Metrics</a></p></body></html>`)
+	})
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info().Str("listen", listen).Int("hosts", len(targets)).Msg("Serving metrics on /metrics")
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// collect gathers the stats of every target and replaces the snapshot served on /metrics
+func (e *exporter) collect() {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	start := time.Now()
+
+	reconnectTargets(e.targets, e.parallel)
+	collectTargets(e.targets, e.parallel, e.withRoot, e.sh)
+
+	r := metrics.NewRegistry()
+
+	for _, t := range e.targets {
+
+		up := 0.0
+
+		if t.Err == nil {
+			up = 1
+		} else {
+			log.Debug().Err(t.Err).Str("host", t.Name).Msg("Host is down")
+		}
+
+		r.Add("mitosu_up", metrics.Gauge, "Whether the last collection from the host succeeded.", up, metrics.L("host", t.Name))
+	}
+
+	r.Add("mitosu_collection_duration_seconds", metrics.Gauge, "Time taken to collect from every host.", time.Since(start).Seconds())
+
+	for _, t := range e.targets {
+
+		if t.Err == nil {
+			metrics.AddStats(r, t.Name, t.Stats)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := r.WriteText(&buf); err != nil {
+		log.Error().Err(err).Msg("Could not write metrics")
+		return
+	}
+
+	e.snapshot = buf.Bytes()
+}
+
+func (e *exporter) getSnapshot() []byte {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.snapshot
+}
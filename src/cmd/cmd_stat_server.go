@@ -8,125 +8,126 @@ import (
 	"mitosu/src/data"
 	cf "mitosu/src/display"
 	"mitosu/src/shell"
-	"mitosu/src/ssh"
+	"net"
 	"os"
 	"os/signal"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v3"
 )
 
-func CmdStat(ctx context.Context, c *cli.Command, systemStats []data.SystemStat) error {
+func CmdStat(ctx context.Context, c *cli.Command, newStats func() []data.SystemStat) error {
 
 	noColor := c.Value("no-color").(bool)
 	cf.SetColorEnabled(!noColor)
 
 	withRoot := c.Value("with-root").(bool)
 	poll := c.Value("poll").(uint)
+	parallel := c.Value("parallel").(uint)
 
-	jsonOutput := c.Value("json").(bool)
+	format := c.Value("format").(string)
 	noPrompt := c.Value("no-prompt").(bool)
 	noPassSudo := c.Value("no-pass-sudo").(bool)
 
-	sshConfig := ssh.ExpandPath(c.Value("config").(string))
-	sshAlias := c.Value("alias").(string)
-	sshHost := c.Value("host").(string)
-	sshPort := c.Value("port").(int)
-	sshUser := c.Value("user").(string)
-	sshKey := ssh.ExpandPath(c.Value("key").(string))
-	sshUserPassword := c.Value("user-pass").(string)
-	sshKeyPassword := c.Value("key-pass").(string)
-
 	log.Debug().
 		Uint("poll", poll).
+		Uint("parallel", parallel).
 		Bool("no-pass-sudo", noPassSudo).
 		Bool("with-root", withRoot).
-		Bool("json", jsonOutput).
+		Str("format", format).
 		Bool("no-prompt", noPrompt).
 		Bool("color", !noColor).
-		Str("path", sshConfig).
-		Str("alias", sshAlias).
-		Str("host", sshHost).
-		Int("port", sshPort).
-		Str("user", sshUser).
-		Str("key", sshKey).
+		Str("path", c.Value("config").(string)).
+		Strs("alias", c.Value("alias").([]string)).
+		Str("hosts-file", c.Value("hosts-file").(string)).
+		Str("host", c.Value("host").(string)).
+		Int("port", c.Value("port").(int)).
+		Str("user", c.Value("user").(string)).
+		Str("key", c.Value("key").(string)).
+		Str("jump", c.Value("jump").(string)).
+		Str("strict-host-key-checking", c.Value("strict-host-key-checking").(string)).
+		Bool("insecure-ignore-host-key", c.Value("insecure-ignore-host-key").(bool)).
 		Msg("About to run stat")
 
-	client := ssh.SSHClient{
-		Config: ssh.Section{
-			Name:         "mitosu CLI",
-			Hostname:     sshHost,
-			Port:         sshPort,
-			User:         sshUser,
-			IdentityFile: sshKey,
-		},
-		Passwords: ssh.SSHPasswords{
-			KeyPassword:  sshKeyPassword,
-			UserPassword: sshUserPassword,
-			CanPrompt:    !noPrompt,
-		},
-		SudoRequiresPassword: !noPassSudo,
+	switch format {
+	case "text", "json", "ndjson":
+	default:
+		return fmt.Errorf("Unknown format '%s', expected text, json or ndjson", format)
 	}
 
-	if sshAlias != "" {
+	if c.Value("json").(bool) && format == "text" {
+		format = "json"
+	}
 
-		config, err := ssh.ParseConfig(sshConfig)
+	jsonOutput := format == "json"
 
-		if err != nil {
-			return err
-		}
+	targets, err := getTargets(c, newStats)
 
-		for _, section := range config.Sections {
+	if err != nil {
+		return err
+	}
 
-			if sshAlias != section.Name {
-				continue
-			}
+	for _, t := range targets {
+		// when polling reuse one shell, instead of starting a new one and sending the sudo password every tick
+		if t.Client != nil {
+			t.Client.KeepShell = poll > 0
+		}
+	}
 
-			log.Debug().
-				Str("alias", sshAlias).
-				Str("user", section.User).
-				Str("host", section.Hostname).
-				Int("port", section.Port).
-				Str("key", section.IdentityFile).
-				Msg("Found ssh host alias")
+	connectTargets(targets, int(parallel))
+	defer closeTargets(targets)
 
-			client.Config = section
+	// a single host behaves as if it was the only thing we are doing, so errors abort
+	single := len(targets) == 1
 
-			if err := client.Connect(); err != nil {
-				return err
-			} else {
-				break
-			}
-		}
-	} else if err := client.Connect(); err != nil {
-		return err
+	if single && targets[0].Err != nil {
+		return targets[0].Err
 	}
 
-	if client.Client == nil {
-		return fmt.Errorf("Could not get ssh connection")
-	}
-	defer client.Close()
+	if !slices.ContainsFunc(targets, func(t *target) bool { return t.Err == nil }) {
 
-	if err := client.PromptRootPass(); err != nil {
-		return err
+		if format == "ndjson" {
+			writeReports(json.NewEncoder(os.Stdout), targets)
+		} else {
+			printTargets(jsonOutput, &cf.VirtualTerm{}, targets)
+		}
+		return fmt.Errorf("Could not connect to any host")
 	}
 
 	sh := shell.PosixShell{}
-	allCmds := make([]shell.ShellCmd, 0)
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if format == "ndjson" {
+		return streamTargets(ctx, targets, poll, int(parallel), withRoot, sh)
+	}
+
 	if !noColor {
 		cf.SetColorEnabled(cf.SupportsANSI())
 	}
 
+	keys := make(chan []byte, 8)
+
 	output := cf.VirtualTerm{
 		FD:           int(os.Stdin.Fd()),
 		SupportsAnsi: cf.SupportsANSI(),
+		OnKey: func(key []byte) {
+			select {
+			case keys <- key:
+			default:
+			}
+		},
+	}
+
+	if slices.ContainsFunc(targets[0].Stats, func(s data.SystemStat) bool { _, ok := s.(*data.ProcessSystemStat); return ok }) {
+		output.Hint = ", c/m to sort processes by CPU/memory"
 	}
 
 	var ticker *time.Ticker
@@ -152,83 +153,207 @@ func CmdStat(ctx context.Context, c *cli.Command, systemStats []data.SystemStat)
 
 		defer func() {
 			output.Restore()
-			PrintStats(jsonOutput, &output, systemStats)
+			printTargets(jsonOutput, &output, targets)
 			log.Debug().Err(err).Msg("Virtual term closed")
 		}()
 	}
 
 	for {
-		allCmds = allCmds[0:0]
 
-		for _, stat := range systemStats {
+		// a host whose connection dropped is connected again, like with ndjson
+		reconnectTargets(targets, int(parallel))
+		collectTargets(targets, int(parallel), withRoot, sh)
 
-			for _, cmd := range stat.GetCmds(sh.GetType()) {
+		// when polling the host is retried on the next poll instead
+		if single && targets[0].Err != nil && poll <= 0 {
+			return targets[0].Err
+		}
 
-				allCmds = append(allCmds, cmd)
-			}
+		printTargets(jsonOutput, &output, targets)
+
+		if poll <= 0 {
+			break
 		}
 
-		results, err := client.RunCommands(withRoot, sh, allCmds)
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
 
-		if err != nil {
-			return err
+			case key := <-keys:
+				if sortProcesses(targets, key) {
+					printTargets(jsonOutput, &output, targets)
+				}
+
+			case <-ticker.C:
+				break wait
+			}
 		}
+	}
 
-		i := 0
-		for _, stat := range systemStats {
+	return nil
+}
+
+// streamTargets writes a report per target to stdout on every poll, one compact JSON document per line,
+// so the output can be piped to jq or a log shipper. Hosts which fail are reported and retried on the next poll.
+func streamTargets(ctx context.Context, targets []*target, poll uint, parallel int, withRoot bool, sh shell.Shell) error {
 
-			n := stat.CmdCount(sh.GetType())
-			stat.ParseCmdOutput(sh.GetType(), results[i:i+n])
-			i += n
+	enc := json.NewEncoder(os.Stdout)
+
+	var ticker *time.Ticker
+
+	if poll > 0 {
+		ticker = time.NewTicker(time.Duration(poll) * time.Second)
+		defer ticker.Stop()
+	}
+
+	for {
+
+		reconnectTargets(targets, parallel)
+		collectTargets(targets, parallel, withRoot, sh)
+
+		if poll <= 0 && len(targets) == 1 && targets[0].Err != nil {
+			return targets[0].Err
 		}
 
-		PrintStats(jsonOutput, &output, systemStats)
+		if err := writeReports(enc, targets); err != nil {
+			return err
+		}
 
 		if poll <= 0 {
-			break
+			return nil
 		}
 
 		select {
 		case <-ctx.Done():
 			return nil
-
 		case <-ticker.C:
 		}
 	}
+}
+
+// writeReports writes the report of every target on its own line
+func writeReports(enc *json.Encoder, targets []*target) error {
+
+	for _, t := range targets {
+
+		if err := enc.Encode(newReport(t)); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func PrintStats(asJson bool, output *cf.VirtualTerm, stats []data.SystemStat) {
+// sortProcesses changes how processes are sorted for the key, returning false if the key is not a sort key
+func sortProcesses(targets []*target, key []byte) bool {
 
-	output.Clear()
+	var sortBy data.ProcessSort
 
-	if asJson {
+	switch string(key) {
+	case "c", "C":
+		sortBy = data.ProcessSortCPU
+	case "m", "M":
+		sortBy = data.ProcessSortMem
+	default:
+		return false
+	}
+
+	for _, t := range targets {
+		for _, stat := range t.Stats {
+			if procs, ok := stat.(*data.ProcessSystemStat); ok {
+				procs.SortBy = sortBy
+			}
+		}
+	}
 
-		b, err := json.MarshalIndent(stats, "", "    ")
+	return true
+}
 
-		if err != nil {
+// printTargets prints the stats of every target, with a section per host when there is more than one.
+// As JSON a single host is a report, and several hosts are an object with the reports keyed by host.
+func printTargets(asJson bool, output *cf.VirtualTerm, targets []*target) {
+
+	output.Clear()
 
-			output.Line("Error encoding json: %s", err)
+	if asJson {
 
+		if len(targets) == 1 {
+			printJson(output, newReport(targets[0]))
 		} else {
+			reports := make([]data.Report, 0, len(targets))
 
-			for line := range bytes.SplitSeq(b, []byte{'\n'}) {
-				output.Line("%s", string(line))
+			for _, t := range targets {
+				reports = append(reports, newReport(t))
 			}
+
+			printJson(output, data.NewReports(reports))
 		}
 
-	} else {
+	} else if len(targets) == 1 {
+
+		if targets[0].Err != nil {
+			output.Line("")
+			output.Line("%s : %s", cf.Redbold(cf.LPad("Error", 30)), cf.Red(targets[0].Err.Error()))
+		}
 
-		for _, stat := range stats {
+		for _, stat := range targets[0].Stats {
 			PrintStat(output, stat)
 		}
+
+	} else {
+
+		for _, t := range targets {
+
+			output.Line("")
+			output.Line("%s", cf.BlueBold(fmt.Sprintf("==> %s <==", t.Name)))
+
+			if t.Err != nil {
+				output.Line("")
+				output.Line("%s : %s", cf.Redbold(cf.LPad("Error", 30)), cf.Red(t.Err.Error()))
+				output.Line("")
+				continue
+			}
+
+			for _, stat := range t.Stats {
+				PrintStat(output, stat)
+			}
+		}
 	}
 
 	output.UpdateScreenSize()
 	output.Redraw()
 }
 
+// newReport creates the JSON report of a target, a target which was never collected is stamped with now
+func newReport(t *target) data.Report {
+
+	collected := t.Collected
+
+	if collected.IsZero() {
+		collected = time.Now()
+	}
+
+	return data.NewReport(t.Name, collected, t.Stats, t.Err)
+}
+
+func printJson(output *cf.VirtualTerm, v any) {
+
+	b, err := json.MarshalIndent(v, "", "    ")
+
+	if err != nil {
+
+		output.Line("Error encoding json: %s", err)
+
+	} else {
+
+		for line := range bytes.SplitSeq(b, []byte{'\n'}) {
+			output.Line("%s", string(line))
+		}
+	}
+}
+
 func PrintStat(t *cf.VirtualTerm, stat data.SystemStat) {
 
 	pad := 30
@@ -239,6 +364,30 @@ func PrintStat(t *cf.VirtualTerm, stat data.SystemStat) {
 
 	switch v := stat.(type) {
 
+	case *data.InventorySystemStat:
+
+		t.Line("")
+		t.Line("%s : %s", cf.MagentaBold(cf.LPad("Inventory", pad)), cf.GreenBold(v.Hostname))
+		t.Line("%s : %s", cf.Bold(cf.LPad("OS", pad)), cf.Cyan(v.OSName))
+		t.Line("%s : %s %s", cf.Bold(cf.LPad("Kernel", pad)), cf.Cyan(v.Kernel), cf.DarkGray(v.Arch))
+		t.Line("%s : %s %s", cf.Bold(cf.LPad("CPU", pad)), cf.Cyan(v.CPUModel),
+			cf.DarkGray(fmt.Sprintf("%d sockets, %d cores, %d threads", v.CPUSockets, v.CPUCores, v.CPUThreads)))
+		t.Line("%s : %s", cf.Bold(cf.LPad("Memory", pad)), cf.Cyan(strings.TrimSpace(cf.FmtByteU64(v.MemTotal, memAlign))))
+
+		virt := v.Virtualization
+		if virt == "" {
+			virt = "unknown"
+		}
+
+		t.Line("%s : %s %s", cf.Bold(cf.LPad("Virtualization", pad)), cf.Cyan(virt), cf.DarkGray(strings.TrimSpace(v.Vendor+" "+v.Product)))
+
+		if !v.BootTime.IsZero() {
+			t.Line("%s : %s %s", cf.Bold(cf.LPad("Booted", pad)), cf.Cyan(v.BootTime.Format(time.DateTime)+" UTC"),
+				cf.DarkGray(cf.FmtDuration(time.Since(v.BootTime))+" ago"))
+		}
+
+		t.Line("%s : %s %s", cf.Bold(cf.LPad("Timezone", pad)), cf.Cyan(v.Timezone), cf.DarkGray(v.UTCOffset))
+
 	case *data.ProcInfoSystemStat:
 
 		d := int(v.Uptime.Hours()) / 24
@@ -253,26 +402,103 @@ func PrintStat(t *cf.VirtualTerm, stat data.SystemStat) {
 
 		t.Line("")
 
-		t.Line("%s :  1m %s", cf.Bold(cf.LPad("Load Avg", pad)), cf.Bold(v.Load1))
-		t.Line("%s :  5m %s", cf.Bold(cf.LPad("        ", pad)), cf.Bold(v.Load5))
-		t.Line("%s : 10m %s", cf.Bold(cf.LPad("        ", pad)), cf.Bold(v.Load10))
+		t.Line("%s :  1m %s", cf.Bold(cf.LPad("Load Avg", pad)), cf.Bold(fmt.Sprintf("%.2f", v.Load1)))
+		t.Line("%s :  5m %s", cf.Bold(cf.LPad("        ", pad)), cf.Bold(fmt.Sprintf("%.2f", v.Load5)))
+		t.Line("%s : 15m %s", cf.Bold(cf.LPad("        ", pad)), cf.Bold(fmt.Sprintf("%.2f", v.Load15)))
 
 		t.Line("")
 
-		t.Line("%s : %s running of %s total", cf.Bold(cf.LPad("Processes", pad)), cf.Cyan(v.RunningProcs), cf.Cyan(v.TotalProcs))
+		t.Line("%s : %s running of %s total", cf.Bold(cf.LPad("Processes", pad)), cf.Cyan(strconv.Itoa(v.RunningProcs)), cf.Cyan(strconv.Itoa(v.TotalProcs)))
 
 		t.Line("")
 
+		// usage draws a bar of used out of total
+		usage := func(name string, used, total uint64) {
+
+			var p float32
+			if total > 0 {
+				p = float32(float64(used) / float64(total) * 100)
+			}
+
+			t.Line("%s : %s %s  %s of %s",
+				cf.Bold(cf.LPad(name, pad)),
+				cf.LevelColor(cf.FmtBar(p, 20), p),
+				cf.LevelColor(cf.FmtPercent(p, cpuAlgin+1), p),
+				cf.Cyan(cf.FmtByteU64(used, memAlign)),
+				cf.Cyan(cf.FmtByteU64(total, memAlign)),
+			)
+		}
+
 		t.Line("%s : ", cf.MagentaBold(cf.LPad("Memory", pad)))
+		usage("Used", v.MemUsed, v.MemTotal)
 		t.Line("%s : %s", cf.Bold(cf.LPad("Total", pad)), cf.Cyan(cf.FmtByteU64(v.MemTotal, memAlign)))
+		t.Line("%s : %s", cf.Bold(cf.LPad("Available", pad)), cf.Cyan(cf.FmtByteU64(v.MemAvailable, memAlign)))
 		t.Line("%s : %s", cf.Bold(cf.LPad("Free", pad)), cf.Cyan(cf.FmtByteU64(v.MemFree, memAlign)))
 		t.Line("%s : %s", cf.Bold(cf.LPad("Buffers", pad)), cf.Cyan(cf.FmtByteU64(v.MemBuffers, memAlign)))
 		t.Line("%s : %s", cf.Bold(cf.LPad("Cached", pad)), cf.Cyan(cf.FmtByteU64(v.MemCached, memAlign)))
+		t.Line("%s : %s", cf.Bold(cf.LPad("Shmem", pad)), cf.Cyan(cf.FmtByteU64(v.MemShmem, memAlign)))
+		t.Line("%s : %s  %s reclaimable", cf.Bold(cf.LPad("Slab", pad)), cf.Cyan(cf.FmtByteU64(v.MemSlab, memAlign)), cf.Cyan(cf.FmtByteU64(v.MemSReclaimable, memAlign)))
+		t.Line("%s : %s  %s writeback", cf.Bold(cf.LPad("Dirty", pad)), cf.Cyan(cf.FmtByteU64(v.MemDirty, memAlign)), cf.Cyan(cf.FmtByteU64(v.MemWriteback, memAlign)))
+
+		// over 100% when more is allocated than the commit limit
+		usage("Committed", v.CommittedAS, v.CommitLimit)
+
+		if v.HugePagesTotal > 0 {
+			usage("HugePages", (v.HugePagesTotal-min(v.HugePagesFree, v.HugePagesTotal))*v.HugePageSize, v.HugePagesTotal*v.HugePageSize)
+		}
+
+		t.Line("")
+
+		if v.SwapTotal > 0 {
+			usage("Swap Used", v.SwapUsed, v.SwapTotal)
+		}
 		t.Line("%s : %s", cf.Bold(cf.LPad("Swap Total", pad)), cf.Cyan(cf.FmtByteU64(v.SwapTotal, memAlign)))
 		t.Line("%s : %s", cf.Bold(cf.LPad("Swap Free", pad)), cf.Cyan(cf.FmtByteU64(v.SwapFree, memAlign)))
 
 		t.Line("")
 
+		pressures := []struct {
+			name     string
+			pressure *data.Pressure
+		}{
+			{"cpu", v.Pressure.CPU},
+			{"memory", v.Pressure.Memory},
+			{"io", v.Pressure.IO},
+		}
+
+		if v.Pressure.CPU != nil || v.Pressure.Memory != nil || v.Pressure.IO != nil {
+
+			header := func(name string) string {
+				return fmt.Sprintf("%s %6s %6s %6s", cf.RPad(name, 12), "10s", "60s", "300s")
+			}
+
+			t.Line("%s : %s   %s", cf.MagentaBold(cf.LPad("Pressure", pad)), cf.DarkGray(header("some")), cf.DarkGray(header("full")))
+
+			for _, p := range pressures {
+
+				if p.pressure == nil {
+					continue
+				}
+
+				some := p.pressure.Some
+				full := p.pressure.Full
+
+				t.Line("%s : %s %s %s %s   %s %s %s %s",
+					cf.Bold(cf.LPad(p.name, pad)),
+					cf.LevelColor(cf.FmtBar(some.Avg10, 10), some.Avg10),
+					cf.LevelColor(cf.FmtPercent(some.Avg10, 5), some.Avg10),
+					cf.Cyan(cf.FmtPercent(some.Avg60, 5)),
+					cf.Cyan(cf.FmtPercent(some.Avg300, 5)),
+					cf.LevelColor(cf.FmtBar(full.Avg10, 10), full.Avg10),
+					cf.LevelColor(cf.FmtPercent(full.Avg10, 5), full.Avg10),
+					cf.Cyan(cf.FmtPercent(full.Avg60, 5)),
+					cf.Cyan(cf.FmtPercent(full.Avg300, 5)),
+				)
+			}
+
+			t.Line("")
+		}
+
 		if v.CPU.Total == 0 {
 			t.Line("%s : No CPU yet, use --poll ", cf.MagentaBold(cf.LPad("CPU", pad)))
 		} else {
@@ -288,6 +514,33 @@ func PrintStat(t *cf.VirtualTerm, stat data.SystemStat) {
 			t.Line("%s : %s", cf.Bold(cf.LPad("Guest", pad)), cf.Cyan(cf.FmtPercent(v.CPU.Guest, cpuAlgin)))
 		}
 
+		if len(v.Cores) > 0 && v.CPU.Total != 0 {
+
+			t.Line("")
+			t.Line("%s : ", cf.MagentaBold(cf.LPad("CPU Cores", pad)))
+
+			for i, core := range v.Cores {
+
+				// offline, or no previous sample to compare with
+				if core == nil {
+					t.Line("%s : %s", cf.Bold(cf.LPad(fmt.Sprintf("cpu%d", i), pad)), cf.DarkGray("unknown"))
+					continue
+				}
+
+				used := core.Used()
+
+				t.Line("%s : %s %s   usr %s  sys %s  iow %s  stl %s",
+					cf.Bold(cf.LPad(fmt.Sprintf("cpu%d", i), pad)),
+					cf.LevelColor(cf.FmtBar(used, 20), used),
+					cf.LevelColor(cf.FmtPercent(used, cpuAlgin+1), used),
+					cf.Cyan(cf.FmtPercent(core.User, cpuAlgin)),
+					cf.Cyan(cf.FmtPercent(core.System, cpuAlgin)),
+					cf.Cyan(cf.FmtPercent(core.Iowait, cpuAlgin)),
+					cf.Cyan(cf.FmtPercent(core.Steal, cpuAlgin)),
+				)
+			}
+		}
+
 		t.Line("")
 
 	case *data.FSSystemStat:
@@ -342,6 +595,35 @@ func PrintStat(t *cf.VirtualTerm, stat data.SystemStat) {
 
 		t.Line("")
 
+	case *data.DiskIOSystemStat:
+
+		if len(v.Disks) < 1 {
+			break
+		}
+
+		t.Line("")
+		t.Line("%s : ", cf.MagentaBold(cf.LPad("Disk I/O", pad)))
+
+		for _, disk := range v.Disks {
+
+			t.StartLine()
+			t.Print("%s : ", cf.Bold(cf.LPad(disk.Name, pad)))
+			t.Print("read %s/s  ", cf.Cyan(cf.FmtByteU64(disk.ReadBytesPerSec, nwAlign)))
+			t.Print("write %s/s  ", cf.Cyan(cf.FmtByteU64(disk.WriteBytesPerSec, nwAlign)))
+			t.Print("r/s %s  ", cf.Cyan(cf.LPad(strconv.FormatFloat(float64(disk.ReadIOPS), 'f', 1, 32), 7)))
+			t.Print("w/s %s  ", cf.Cyan(cf.LPad(strconv.FormatFloat(float64(disk.WriteIOPS), 'f', 1, 32), 7)))
+			t.Print("await %s ms  ", cf.Cyan(cf.LPad(strconv.FormatFloat(float64(disk.Await), 'f', 1, 32), 6)))
+			t.Print("%s %s", cf.FmtBar(disk.Util, 10), cf.LevelColor(cf.FmtPercent(disk.Util, 5), disk.Util))
+
+			if len(disk.Mounts) > 0 {
+				t.Print("  %s", cf.Bold(strings.Join(disk.Mounts, ", ")))
+			}
+
+			t.FinishLine()
+		}
+
+		t.Line("")
+
 	case *data.NetIntfSystemStat:
 
 		if len(v.NetIntf) < 1 {
@@ -362,12 +644,327 @@ func PrintStat(t *cf.VirtualTerm, stat data.SystemStat) {
 			intf := v.NetIntf[name]
 			t.StartLine()
 			t.Print("%s : ", cf.Bold(cf.LPad(name, pad)))
-			t.Print("%s   ", cf.Yellow(cf.LPad(intf.IPv4, len("xxx.xxx.xxx.xxx/32"))))
-			t.Print("%s   ", cf.Red(cf.LPad(intf.IPv6, len("xxxx:xxxx:xxxx:xxxx:xxxx:xxxx:xxxx:xxxx/64"))))
+
+			state := cf.RPad(intf.OperState, 7)
+			switch intf.OperState {
+			case "UP":
+				state = cf.Green(state)
+			case "DOWN", "LOWERLAYERDOWN":
+				state = cf.Redbold(state)
+			default:
+				state = cf.Yellow(state)
+			}
+
+			speed := ""
+			if intf.Speed >= 1000 {
+				speed = fmt.Sprintf("%g Gb/s", float32(intf.Speed)/1000)
+			} else if intf.Speed > 0 {
+				speed = fmt.Sprintf("%d Mb/s", intf.Speed)
+			}
+
+			t.Print("%s mtu %s  %s %s  ", state, cf.LPad(strconv.Itoa(intf.MTU), 5), cf.RPad(intf.MAC, len("xx:xx:xx:xx:xx:xx")), cf.LPad(speed, len("100 Gb/s")))
 			t.Print(" in %s  ", cf.Green(cf.FmtByteU64(intf.Rx, nwAlign)))
 			t.Print("out %s", cf.Green(cf.FmtByteU64(intf.Tx, nwAlign)))
+
+			if v.Elapsed > 0 {
+
+				t.Print("   rx %s/s %s  ", cf.Cyan(cf.FmtByteU64(intf.RxBytesPerSec, nwAlign)), cf.Cyan(cf.LPad(strconv.FormatFloat(float64(intf.RxPacketsPerSec), 'f', 0, 32), 6)+" p/s"))
+				t.Print("tx %s/s %s", cf.Cyan(cf.FmtByteU64(intf.TxBytesPerSec, nwAlign)), cf.Cyan(cf.LPad(strconv.FormatFloat(float64(intf.TxPacketsPerSec), 'f', 0, 32), 6)+" p/s"))
+
+				errs := intf.Delta.RxErrs + intf.Delta.TxErrs
+				drops := intf.Delta.RxDrop + intf.Delta.TxDrop
+
+				if errs > 0 || drops > 0 {
+					t.Print("   %s", cf.Redbold(fmt.Sprintf("err %d drop %d", errs, drops)))
+				}
+			}
 			t.FinishLine()
+
+			for _, addr := range intf.Addrs {
+
+				color := cf.Yellow
+				if addr.Family == "inet6" {
+					color = cf.Red
+				}
+
+				t.StartLine()
+				t.Print("%s   %s %s", cf.LPad("", pad), color(cf.RPad(addr.String(), len("xxxx:xxxx:xxxx:xxxx:xxxx:xxxx:xxxx:xxxx/64"))), cf.RPad(addr.Scope, 6))
+
+				if len(addr.Flags) > 0 {
+					t.Print(" %s", cf.DarkGray(strings.Join(addr.Flags, " ")))
+				}
+
+				if addr.Label != "" && addr.Label != name {
+					t.Print(" %s", cf.Bold(addr.Label))
+				}
+				t.FinishLine()
+			}
+		}
+		t.Line("")
+
+	case *data.ProcessSystemStat:
+
+		top := v.Top()
+
+		if len(top) < 1 {
+			break
 		}
+
+		sortedBy := "CPU"
+		if v.SortBy == data.ProcessSortMem {
+			sortedBy = "Memory"
+		}
+
+		t.Line("")
+		t.Line("%s : %s", cf.MagentaBold(cf.LPad("Top Processes", pad)), cf.DarkGray("by "+sortedBy))
+		t.Line("%s   %s %s %s %s %s  %s",
+			cf.Bold(cf.LPad("PID", pad)),
+			cf.Bold(cf.RPad("USER", 12)),
+			cf.Bold(cf.RPad("S", 2)),
+			cf.Bold(cf.LPad("CPU", 7)),
+			cf.Bold(cf.LPad("RSS", 11)),
+			cf.Bold(cf.LPad("THR", 4)),
+			cf.Bold("COMMAND"),
+		)
+
+		for _, p := range top {
+
+			t.Line("%s : %s %s %s %s %s  %s",
+				cf.Bold(cf.LPad(strconv.Itoa(p.PID), pad)),
+				cf.Yellow(cf.RPad(p.User, 12)),
+				cf.RPad(p.State, 2),
+				cf.Cyan(cf.FmtPercent(p.CPU, 6)),
+				cf.Cyan(cf.FmtByteU64(p.RSS, 6)),
+				cf.LPad(strconv.Itoa(p.Threads), 4),
+				p.Command,
+			)
+		}
+
+		t.Line("")
+
+	case *data.SystemdSystemStat:
+
+		t.Line("")
+
+		if !v.Running {
+			t.Line("%s : %s", cf.MagentaBold(cf.LPad("Systemd", pad)), cf.DarkGray("not running"))
+			t.Line("")
+			break
+		}
+
+		if len(v.Failed) == 0 {
+			t.Line("%s : %s", cf.MagentaBold(cf.LPad("Systemd", pad)), cf.Green("no failed units"))
+		} else {
+			t.Line("%s : %s", cf.MagentaBold(cf.LPad("Systemd", pad)), cf.Redbold(fmt.Sprintf("%d failed units", len(v.Failed))))
+		}
+
+		for _, unit := range v.Failed {
+			t.Line("%s : %s", cf.Bold(cf.LPad(unit.Name, pad)), systemdUnitState(unit))
+		}
+
+		if len(v.Watched) > 0 {
+
+			t.Line("")
+
+			for _, unit := range v.Watched {
+				t.Line("%s : %s", cf.Bold(cf.LPad(unit.Name, pad)), systemdUnitState(unit))
+			}
+		}
+
+		t.Line("")
+
+	case *data.SocketsSystemStat:
+
+		if v.Source == "" {
+			break
+		}
+
+		t.Line("")
+		t.Line("%s : %s TCP sockets   %s of the ephemeral ports   %s",
+			cf.MagentaBold(cf.LPad("Sockets", pad)),
+			cf.Bold(strconv.Itoa(v.TCPTotal)),
+			cf.LevelColor(cf.FmtPercent(v.EphemeralUsedPerc(), 5), v.EphemeralUsedPerc()),
+			cf.DarkGray(v.Source),
+		)
+
+		for _, state := range data.TCPStateOrder {
+
+			n, ok := v.TCPStates[state]
+
+			if !ok {
+				continue
+			}
+
+			count := cf.LPad(strconv.Itoa(n), 6)
+
+			// sockets the application never closed
+			if state == "CLOSE_WAIT" && n > 0 {
+				count = cf.YellowBold(count)
+			} else {
+				count = cf.Cyan(count)
+			}
+
+			t.Line("%s : %s", cf.Bold(cf.LPad(state, pad)), count)
+		}
+
+		if v.TCPOrphaned > 0 {
+			t.Line("%s : %s", cf.Bold(cf.LPad("ORPHANED", pad)), cf.Yellow(cf.LPad(strconv.Itoa(v.TCPOrphaned), 6)))
+		}
+
+		if len(v.Listening) > 0 {
+
+			t.Line("")
+			t.Line("%s : %s %s",
+				cf.MagentaBold(cf.LPad("Listening", pad)),
+				cf.Bold(cf.RPad("ADDRESS", 30)),
+				cf.Bold("PROCESS"),
+			)
+
+			for _, socket := range v.Listening {
+
+				address := net.JoinHostPort(socket.Address, strconv.Itoa(socket.Port))
+
+				procs := make([]string, 0, len(socket.Processes))
+				for _, proc := range socket.Processes {
+					procs = append(procs, fmt.Sprintf("%s (%d)", proc.Name, proc.PID))
+				}
+
+				t.Line("%s : %s %s",
+					cf.Bold(cf.LPad(socket.Protocol, pad)),
+					cf.Cyan(cf.RPad(address, 30)),
+					strings.Join(procs, ", "),
+				)
+			}
+		}
+
+		t.Line("")
+
+	case *data.SensorsSystemStat:
+
+		if len(v.Sensors) < 1 {
+			break
+		}
+
+		t.Line("")
+		t.Line("%s : ", cf.MagentaBold(cf.LPad("Sensors", pad)))
+
+		for _, sensor := range v.Sensors {
+
+			value := fmt.Sprintf("%7.1f °C", sensor.Value)
+			if sensor.Kind == "fan" {
+				value = fmt.Sprintf("%6.0f RPM", sensor.Value)
+			}
+
+			switch {
+			case sensor.OverCrit():
+				value = cf.Redbold(value)
+			case sensor.OverHigh():
+				value = cf.YellowBold(value)
+			default:
+				value = cf.Green(value)
+			}
+
+			thresholds := make([]string, 0, 3)
+
+			if sensor.High > 0 {
+				thresholds = append(thresholds, fmt.Sprintf("high %.1f°C", sensor.High))
+			}
+			if sensor.Crit > 0 {
+				thresholds = append(thresholds, fmt.Sprintf("crit %.1f°C", sensor.Crit))
+			}
+			if sensor.Min > 0 {
+				thresholds = append(thresholds, fmt.Sprintf("min %.0f RPM", sensor.Min))
+			}
+
+			t.Line("%s : %s   %s   %s",
+				cf.Bold(cf.LPad(sensor.Label, pad)),
+				value,
+				cf.Cyan(cf.RPad(sensor.Chip, 14)),
+				cf.DarkGray(strings.Join(thresholds, "  ")),
+			)
+		}
+
+		t.Line("")
+
+	case *data.DockerDiskSystemStat:
+
+		if len(v.Usage) < 1 {
+			break
+		}
+
+		t.Line("")
+		t.Line("%s : %s %s %s %s",
+			cf.MagentaBold(cf.LPad("Docker Disk", pad)),
+			cf.Bold(cf.LPad("TOTAL", 6)),
+			cf.Bold(cf.LPad("ACTIVE", 6)),
+			cf.Bold(cf.LPad("SIZE", 10)),
+			cf.Bold(cf.LPad("RECLAIMABLE", 10)),
+		)
+
+		for _, u := range v.Usage {
+
+			t.Line("%s : %s %s %s %s %s",
+				cf.Bold(cf.LPad(strings.ReplaceAll(u.Type, "_", " "), pad)),
+				cf.LPad(strconv.Itoa(u.Count), 6),
+				cf.LPad(strconv.Itoa(u.Active), 6),
+				cf.Cyan(cf.FmtByteU64(u.Size, 6)),
+				cf.Cyan(cf.FmtByteU64(u.Reclaimable, 6)),
+				cf.LevelColor(cf.FmtPercent(u.ReclaimablePerc(), 5), u.ReclaimablePerc()),
+			)
+		}
+
+		if len(v.Images) > 0 {
+
+			t.Line("")
+			t.Line("%s : %s %s %s",
+				cf.MagentaBold(cf.LPad("Largest Images", pad)),
+				cf.Bold(cf.LPad("SIZE", 10)),
+				cf.Bold(cf.LPad("UNIQUE", 10)),
+				cf.Bold("CONTAINERS  TAGS"),
+			)
+
+			for _, img := range v.Images {
+
+				tags := strings.Join(img.Tags, " ")
+				if tags == "" || tags == "<none>:<none>" {
+					tags = cf.DarkGray("<none>")
+				}
+
+				t.Line("%s : %s %s %s  %s",
+					cf.Bold(cf.LPad(img.ShortID(), pad)),
+					cf.Cyan(cf.FmtByteU64(img.Size, 6)),
+					cf.Cyan(cf.FmtByteU64(img.UniqueSize, 6)),
+					cf.LPad(strconv.Itoa(img.Containers), 10),
+					tags,
+				)
+			}
+		}
+
+		if len(v.Volumes) > 0 {
+
+			t.Line("")
+			t.Line("%s : %s %s",
+				cf.MagentaBold(cf.LPad("Largest Volumes", pad)),
+				cf.Bold(cf.LPad("SIZE", 10)),
+				cf.Bold("LINKS  NAME"),
+			)
+
+			for _, vol := range v.Volumes {
+
+				name := vol.Name
+				if vol.RefCount == 0 {
+					name += cf.DarkGray(" unused")
+				}
+
+				t.Line("%s : %s %s  %s",
+					cf.Bold(cf.LPad(vol.Driver, pad)),
+					cf.Cyan(cf.FmtByteU64(vol.Size, 6)),
+					cf.LPad(strconv.Itoa(vol.RefCount), 5),
+					name,
+				)
+			}
+		}
+
 		t.Line("")
 
 	case *data.DockerSystemStat:
@@ -377,24 +974,131 @@ func PrintStat(t *cf.VirtualTerm, stat data.SystemStat) {
 		}
 
 		t.Line("")
-		t.Line("%s : ", cf.MagentaBold(cf.LPad("Docker Containers", pad)))
+		t.Line("%s : %s", cf.MagentaBold(cf.LPad("Containers", pad)), cf.DarkGray(v.DockerContainers[0].Runtime))
 
 		for _, ct := range v.DockerContainers {
 
-			t.Line("%s : CPU %s   Mem %s   NetIO %s %s   BlockIO %s %s   PIDS %s   %s ",
-				cf.Bold(cf.LPad(ct.Name, pad)),
-				cf.Bold(cf.LPad(ct.CPU, 6)),
-				cf.Bold(cf.FmtByteU64(ct.MemUsed, 5)),
-				cf.Bold(cf.FmtByteU64(ct.NetIn, 5)),
-				cf.Bold(cf.FmtByteU64(ct.NetOut, 5)),
-				cf.Bold(cf.FmtByteU64(ct.BlockIn, 5)),
-				cf.Bold(cf.FmtByteU64(ct.BlockOut, 5)),
-				cf.Bold(cf.LPad(strconv.FormatUint(ct.PIDs, 10), 4)),
-				cf.Bold(ct.ID[0:len("xxxxxxxxxxxx")]),
-			)
+			if ct.Running() {
+				t.Line("%s : CPU %s   Mem %s   NetIO %s %s   BlockIO %s %s   PIDS %s   %s ",
+					cf.Bold(cf.LPad(ct.Name, pad)),
+					cf.Bold(cf.FmtPercent(ct.CPU, 5)),
+					cf.Bold(cf.FmtByteU64(ct.MemUsed, 5)),
+					cf.Bold(cf.FmtByteU64(ct.NetIn, 5)),
+					cf.Bold(cf.FmtByteU64(ct.NetOut, 5)),
+					cf.Bold(cf.FmtByteU64(ct.BlockIn, 5)),
+					cf.Bold(cf.FmtByteU64(ct.BlockOut, 5)),
+					cf.Bold(cf.LPad(strconv.FormatUint(ct.PIDs, 10), 4)),
+					cf.Bold(ct.ShortID()),
+				)
+			} else {
+				t.Line("%s : %s", cf.Bold(cf.LPad(ct.Name, pad)), cf.Bold(ct.ShortID()))
+			}
+
+			// docker stats without docker ps does not know the state
+			if ct.State != "" {
+				t.Line("%s   %s", cf.LPad("", pad), containerState(ct))
+			}
 		}
 
 		t.Line("")
 
 	}
 }
+
+// containerState shows the state, health, restarts and image of a container, in red when it has a problem
+func containerState(ct data.DockerContainer) string {
+
+	state := ct.State
+
+	// crictl does not show the exit code
+	if ct.State == "exited" && ct.Runtime != "crictl" {
+		state = fmt.Sprintf("%s (%d)", state, ct.ExitCode)
+	}
+
+	since := ct.Since()
+	fromStatus := false
+
+	switch {
+	case !since.IsZero() && ct.Running():
+		state += " for " + cf.FmtDuration(time.Since(since))
+	case !since.IsZero():
+		state += " " + cf.FmtDuration(time.Since(since)) + " ago"
+	case ct.Status != "":
+		// the status is like "Up 2 hours" when the exact time is not known
+		state = ct.Status
+		fromStatus = true
+	}
+
+	switch {
+	case ct.Problem():
+		state = cf.Redbold(state)
+	case ct.Running():
+		state = cf.Green(state)
+	default:
+		state = cf.Yellow(state)
+	}
+
+	parts := []string{state}
+
+	switch {
+	case fromStatus || ct.Health == "":
+		// no health check, or the status already shows it
+	case ct.Health == "healthy":
+		parts = append(parts, cf.Green(ct.Health))
+	case ct.Health == "unhealthy":
+		parts = append(parts, cf.Redbold(ct.Health))
+	default:
+		parts = append(parts, cf.Yellow(ct.Health))
+	}
+
+	if ct.RestartCount > 0 {
+		parts = append(parts, "restarts "+cf.Yellow(strconv.Itoa(ct.RestartCount)))
+	}
+
+	parts = append(parts, cf.DarkGray(ct.Image))
+
+	return strings.Join(parts, "   ")
+}
+
+// systemdUnitState shows the state, restarts and accounting of a unit, in red when it failed
+func systemdUnitState(unit data.SystemdUnit) string {
+
+	state := unit.Active + "/" + unit.Sub
+	if unit.Active == "" || unit.Load == "not-found" {
+		state = unit.Load
+	}
+
+	// padded before it is colored, the color codes would count
+	state = cf.RPad(state, 18)
+
+	switch {
+	case unit.Active == "failed" || unit.Load == "not-found":
+		state = cf.Redbold(state)
+	case unit.Active == "active":
+		state = cf.Green(state)
+	default:
+		state = cf.Yellow(state)
+	}
+
+	parts := []string{state}
+
+	if unit.Result != "" && unit.Result != "success" {
+		parts = append(parts, cf.Red(unit.Result))
+	}
+
+	if unit.Restarts > 0 {
+		parts = append(parts, "restarts "+cf.Yellow(strconv.Itoa(unit.Restarts)))
+	}
+
+	if unit.MemoryBytes > 0 {
+		parts = append(parts, "mem "+cf.Cyan(cf.FmtByteU64(unit.MemoryBytes, 5)))
+	}
+
+	if unit.CPUSeconds > 0 {
+		parts = append(parts, "cpu "+cf.Cyan(cf.FmtPercent(unit.CPUPercent, 5)))
+	}
+
+	parts = append(parts, cf.DarkGray(unit.Description))
+
+	return strings.Join(parts, "   ")
+}
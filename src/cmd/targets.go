@@ -0,0 +1,456 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"mitosu/src/data"
+	"mitosu/src/local"
+	"mitosu/src/shell"
+	"mitosu/src/ssh"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// target is a single remote host and the stats collected from it
+type target struct {
+	Name string
+
+	// Exec runs the commands, it is the Client unless running locally where the Client is nil
+	Exec   shell.Executor
+	Client *ssh.SSHClient
+
+	Stats []data.SystemStat
+	Err   error
+
+	// Collected is when the stats were last collected
+	Collected time.Time
+
+	// configured is set when the client config is valid, so connecting can be retried
+	configured bool
+}
+
+// getTargets builds a client for every host given on the command line.
+// Hosts come from the --alias flags, which can be ssh config patterns like 'db*', and the --hosts-file.
+// When no alias is given a single target is built from the --host flag.
+func getTargets(c *cli.Command, newStats func() []data.SystemStat) ([]*target, error) {
+
+	sshConfig := ssh.ExpandPath(c.Value("config").(string))
+	sshAliases := c.Value("alias").([]string)
+	hostsFile := ssh.ExpandPath(c.Value("hosts-file").(string))
+	sshJump := c.Value("jump").(string)
+
+	if c.Value("local").(bool) || c.Value("docker-exec").(string) != "" || c.Value("kubectl-exec").(string) != "" {
+
+		if len(sshAliases) > 0 || hostsFile != "" {
+			return nil, fmt.Errorf("--local, --docker-exec and --kubectl-exec cannot be used with --alias or --hosts-file")
+		}
+
+		t, err := newLocalTarget(c, newStats)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []*target{t}, nil
+	}
+
+	var config *ssh.SSHConfig
+
+	if len(sshAliases) > 0 || hostsFile != "" || sshJump != "" {
+
+		cfg, err := ssh.ParseConfig(sshConfig)
+
+		if err == nil {
+			config = cfg
+		} else if len(sshAliases) > 0 {
+			return nil, err
+		} else {
+			log.Debug().Err(err).Str("path", sshConfig).Msg("Could not read ssh config")
+			config = &ssh.SSHConfig{Path: sshConfig}
+		}
+	}
+
+	aliases := make([]string, 0, len(sshAliases))
+
+	for _, alias := range sshAliases {
+		aliases = appendAlias(aliases, alias, config)
+	}
+
+	if hostsFile != "" {
+
+		hosts, err := readHostsFile(hostsFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, alias := range hosts {
+			aliases = appendAlias(aliases, alias, config)
+		}
+	}
+
+	if len(aliases) == 0 && len(sshAliases) > 0 {
+		return nil, fmt.Errorf("No hosts matched %s", strings.Join(sshAliases, ", "))
+	}
+
+	if len(aliases) == 0 && hostsFile != "" {
+		return nil, fmt.Errorf("No hosts in the hosts file %s", hostsFile)
+	}
+
+	if len(aliases) == 0 {
+
+		client := newClient(c)
+
+		t := &target{
+			Name:   client.Config.Hostname,
+			Exec:   client,
+			Client: client,
+			Stats:  newStats(),
+			Err:    configureClient(c, client, config),
+		}
+		t.configured = t.Err == nil
+
+		return []*target{t}, nil
+	}
+
+	// every alias would be the same machine under a different name
+	if c.IsSet("host") && (len(aliases) > 1 || hostsFile != "") {
+		return nil, fmt.Errorf("--host cannot be used with --hosts-file or with more than one alias, it would replace the host of every alias")
+	}
+
+	targets := make([]*target, 0, len(aliases))
+
+	for _, alias := range aliases {
+
+		client := newClient(c)
+		section := config.Resolve(alias)
+
+		// options given on the command line take precedence over the config, like with ssh
+		if c.IsSet("host") {
+			section.Hostname = client.Config.Hostname
+		}
+		if c.IsSet("port") {
+			section.Port = client.Config.Port
+		}
+		if c.IsSet("user") {
+			section.User = client.Config.User
+		}
+		if c.IsSet("key") {
+			section.IdentityFile = client.Config.IdentityFile
+		}
+
+		log.Debug().
+			Str("alias", alias).
+			Str("user", section.User).
+			Str("host", section.Hostname).
+			Int("port", section.Port).
+			Str("key", section.IdentityFile).
+			Str("jump", section.ProxyJump).
+			Msg("Found ssh host alias")
+
+		client.Config = section
+
+		t := &target{
+			Name:   alias,
+			Exec:   client,
+			Client: client,
+			Stats:  newStats(),
+			Err:    configureClient(c, client, config),
+		}
+		t.configured = t.Err == nil
+
+		targets = append(targets, t)
+	}
+
+	return targets, nil
+}
+
+// newLocalTarget creates the target for the machine mitosu runs on, named by its hostname,
+// or for a container or pod when --docker-exec or --kubectl-exec is given
+func newLocalTarget(c *cli.Command, newStats func() []data.SystemStat) (*target, error) {
+
+	dockerExec := c.Value("docker-exec").(string)
+	kubectlExec := c.Value("kubectl-exec").(string)
+
+	var exec *local.LocalExecutor
+	var name string
+
+	switch {
+
+	case c.Value("local").(bool) && (dockerExec != "" || kubectlExec != ""), dockerExec != "" && kubectlExec != "":
+		return nil, fmt.Errorf("Only one of --local, --docker-exec and --kubectl-exec can be used")
+
+	case dockerExec != "":
+		exec = local.NewDockerExec(dockerExec)
+		name = dockerExec
+
+	case kubectlExec != "":
+
+		var err error
+
+		if exec, err = local.NewKubectlExec(kubectlExec); err != nil {
+			return nil, err
+		}
+		name = kubectlExec
+
+	default:
+		exec = &local.LocalExecutor{}
+
+		var err error
+
+		if name, err = os.Hostname(); err != nil {
+			name = "localhost"
+		}
+	}
+
+	exec.SudoRequiresPassword = !c.Value("no-pass-sudo").(bool)
+	exec.Password = c.Value("user-pass").(string)
+	exec.CanPrompt = !c.Value("no-prompt").(bool)
+	exec.WithRoot = c.Value("with-root").(bool)
+
+	return &target{
+		Name:       name,
+		Exec:       exec,
+		Stats:      newStats(),
+		configured: true,
+	}, nil
+}
+
+// newClient creates a client from the command line flags
+func newClient(c *cli.Command) *ssh.SSHClient {
+
+	return &ssh.SSHClient{
+		Config: ssh.Section{
+			Name:         "mitosu CLI",
+			Hostname:     c.Value("host").(string),
+			Port:         c.Value("port").(int),
+			User:         c.Value("user").(string),
+			IdentityFile: ssh.ExpandPath(c.Value("key").(string)),
+		},
+		Passwords: ssh.SSHPasswords{
+			KeyPassword:  c.Value("key-pass").(string),
+			UserPassword: c.Value("user-pass").(string),
+			CanPrompt:    !c.Value("no-prompt").(bool),
+		},
+		SudoRequiresPassword: !c.Value("no-pass-sudo").(bool),
+	}
+}
+
+// appendAlias appends the alias, or every ssh config host matching the alias if it's a pattern
+func appendAlias(aliases []string, alias string, config *ssh.SSHConfig) []string {
+
+	if !strings.ContainsAny(alias, "*?") {
+
+		if !slices.Contains(aliases, alias) {
+			aliases = append(aliases, alias)
+		}
+		return aliases
+	}
+
+	for _, host := range config.Hosts() {
+
+		if ssh.MatchPattern(alias, host) && !slices.Contains(aliases, host) {
+			aliases = append(aliases, host)
+		}
+	}
+
+	return aliases
+}
+
+// readHostsFile reads one host or alias per line, ignoring blank lines and # comments
+func readHostsFile(path string) ([]string, error) {
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hosts := make([]string, 0)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+
+		line := scanner.Text()
+
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		hosts = append(hosts, strings.Fields(line)...)
+	}
+
+	return hosts, scanner.Err()
+}
+
+// connectTargets connects to every target using at most parallel connections at once
+func connectTargets(targets []*target, parallel int) {
+
+	forEachParallel(len(targets), parallel, func(i int) {
+
+		t := targets[i]
+
+		if t.Err != nil {
+			return
+		}
+
+		if err := t.Exec.Connect(); err != nil {
+			log.Debug().Err(err).Str("host", t.Name).Msg("Could not connect")
+			t.Err = err
+			return
+		}
+
+		if err := t.Exec.PromptRootPass(); err != nil {
+			t.Err = err
+		}
+	})
+}
+
+// reconnectTargets connects again to every target which failed to connect or run commands
+func reconnectTargets(targets []*target, parallel int) {
+
+	forEachParallel(len(targets), parallel, func(i int) {
+
+		t := targets[i]
+
+		if t.Err == nil || !t.configured {
+			return
+		}
+
+		log.Debug().Err(t.Err).Str("host", t.Name).Msg("Reconnecting")
+
+		if err := t.Exec.Connect(); err != nil {
+			log.Debug().Err(err).Str("host", t.Name).Msg("Could not reconnect")
+			t.Err = err
+			return
+		}
+
+		t.Err = nil
+
+		// the host could have been rebooted or upgraded
+		for _, stat := range t.Stats {
+			if static, ok := stat.(data.StaticStat); ok {
+				static.Reset()
+			}
+		}
+	})
+}
+
+// collectTargets runs the commands of every stat on every connected target and parses the output
+func collectTargets(targets []*target, parallel int, withRoot bool, sh shell.Shell) {
+
+	forEachParallel(len(targets), parallel, func(i int) {
+
+		t := targets[i]
+
+		if !t.Exec.Connected() {
+			return
+		}
+
+		allCmds := make([]shell.ShellCmd, 0)
+
+		for _, stat := range t.Stats {
+			allCmds = append(allCmds, stat.GetCmds(sh.GetType())...)
+		}
+
+		results, err := t.Exec.RunCommands(withRoot, sh, allCmds)
+
+		if err != nil {
+			log.Debug().Err(err).Str("host", t.Name).Msg("Could not run commands")
+			t.Err = err
+			return
+		}
+
+		t.Err = nil
+		t.Collected = time.Now()
+
+		j := 0
+		for _, stat := range t.Stats {
+
+			n := stat.CmdCount(sh.GetType())
+			stat.ParseCmdOutput(sh.GetType(), results[min(j, len(results)):min(j+n, len(results))])
+			j += n
+		}
+	})
+}
+
+func closeTargets(targets []*target) {
+
+	for _, t := range targets {
+
+		if t.Exec.Connected() {
+			t.Exec.Close()
+		}
+	}
+}
+
+// forEachParallel calls fn for 0..n-1 with at most parallel calls running at once
+func forEachParallel(n int, parallel int, fn func(i int)) {
+
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+
+	for i := range n {
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// configureClient resolves the jump hosts and host key checking mode for the client config.
+// The command line flags take precedence over the ProxyJump and StrictHostKeyChecking values from the ssh config.
+func configureClient(c *cli.Command, client *ssh.SSHClient, config *ssh.SSHConfig) error {
+
+	jump := c.Value("jump").(string)
+	hostKeyChecking := c.Value("strict-host-key-checking").(string)
+
+	if jump == "" {
+		jump = client.Config.ProxyJump
+	}
+
+	if jumps, err := ssh.ParseProxyJump(jump, config); err != nil {
+		return err
+	} else {
+		client.Jumps = jumps
+	}
+
+	if c.Value("insecure-ignore-host-key").(bool) {
+
+		client.HostKeyChecking = ssh.HostKeyCheckingInsecure
+
+	} else {
+
+		if hostKeyChecking == "" {
+			hostKeyChecking = client.Config.StrictHostKeyChecking
+		}
+
+		checking, err := ssh.ParseHostKeyChecking(hostKeyChecking)
+
+		if err != nil {
+			return err
+		}
+
+		client.HostKeyChecking = checking
+	}
+
+	return nil
+}
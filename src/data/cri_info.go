@@ -0,0 +1,134 @@
+package data
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// criNumber is a protobuf uint64, which crictl prints as a string or a number depending on its version
+type criNumber struct {
+	Value json.Number `json:"value"`
+}
+
+func (n *criNumber) Uint64() uint64 {
+
+	if n == nil {
+		return 0
+	}
+
+	v, _ := strconv.ParseUint(n.Value.String(), 10, 64)
+	return v
+}
+
+type criMetadata struct {
+	Name    string `json:"name"`
+	Attempt int    `json:"attempt"`
+}
+
+// criContainer is a container from 'crictl ps -o json'
+type criContainer struct {
+	ID       string      `json:"id"`
+	Metadata criMetadata `json:"metadata"`
+	Image    struct {
+		Image string `json:"image"`
+	} `json:"image"`
+	State     string            `json:"state"`
+	CreatedAt json.Number       `json:"createdAt"`
+	Labels    map[string]string `json:"labels"`
+}
+
+// criStats are the stats of a running container from 'crictl stats -o json'
+type criStats struct {
+	Attributes struct {
+		ID string `json:"id"`
+	} `json:"attributes"`
+	CPU struct {
+		UsageNanoCores *criNumber `json:"usageNanoCores"`
+	} `json:"cpu"`
+	Memory struct {
+		WorkingSetBytes *criNumber `json:"workingSetBytes"`
+		AvailableBytes  *criNumber `json:"availableBytes"`
+	} `json:"memory"`
+}
+
+// parseCRI parses the containers from crictl ps followed by their stats from crictl stats
+func (f *DockerSystemStat) parseCRI(out string) {
+
+	dec := json.NewDecoder(strings.NewReader(out))
+
+	var ps struct {
+		Containers []criContainer `json:"containers"`
+	}
+
+	if err := dec.Decode(&ps); err != nil {
+		log.Debug().Err(err).Msg("failed to parse crictl containers")
+		return
+	}
+
+	index := make(map[string]int, len(ps.Containers))
+	now := time.Now()
+
+	for _, c := range ps.Containers {
+
+		container := DockerContainer{
+			ID:    c.ID,
+			Name:  c.Metadata.Name,
+			Image: c.Image.Image,
+
+			// CONTAINER_RUNNING is running
+			State: strings.ToLower(strings.TrimPrefix(c.State, "CONTAINER_")),
+
+			// kubelet creates a new container for every restart, the attempt counts them
+			RestartCount: c.Metadata.Attempt,
+			Labels:       c.Labels,
+		}
+
+		// a new container is created for every start, so it started about when it was created
+		if ns, err := c.CreatedAt.Int64(); err == nil && ns > 0 {
+
+			container.StartedAt = time.Unix(0, ns).UTC()
+
+			if container.Running() {
+				container.UptimeSeconds = now.Sub(container.StartedAt).Seconds()
+			}
+		}
+
+		index[c.ID] = len(f.DockerContainers)
+		f.DockerContainers = append(f.DockerContainers, container)
+	}
+
+	var stats struct {
+		Stats []criStats `json:"stats"`
+	}
+
+	if err := dec.Decode(&stats); err != nil {
+		log.Debug().Err(err).Msg("failed to parse crictl stats")
+		return
+	}
+
+	for _, st := range stats.Stats {
+
+		i, ok := index[st.Attributes.ID]
+
+		if !ok {
+			continue
+		}
+
+		container := &f.DockerContainers[i]
+
+		// 100 is one full core, like docker
+		container.CPU = float32(float64(st.CPU.UsageNanoCores.Uint64()) / 1e9 * 100)
+
+		container.MemUsed = st.Memory.WorkingSetBytes.Uint64()
+
+		// the available bytes are what is left until the limit, there are none without a limit
+		if available := st.Memory.AvailableBytes.Uint64(); available > 0 {
+			container.MemTotal = container.MemUsed + available
+			container.MemPerc = float32(float64(container.MemUsed) / float64(container.MemTotal) * 100)
+		}
+	}
+}
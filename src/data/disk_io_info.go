@@ -0,0 +1,300 @@
+package data
+
+import (
+	"bufio"
+	"mitosu/src/shell"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// diskSectorSize is the unit of the sector counters in /proc/diskstats, it is always 512 no matter the device
+	diskSectorSize = 512
+)
+
+type DiskIORaw struct {
+	Reads        uint64 `json:"reads"`
+	ReadSectors  uint64 `json:"read_sectors"`
+	ReadTicks    uint64 `json:"read_ticks"` // ms spent reading
+	Writes       uint64 `json:"writes"`
+	WriteSectors uint64 `json:"write_sectors"`
+	WriteTicks   uint64 `json:"write_ticks"` // ms spent writing
+	IOTicks      uint64 `json:"io_ticks"`    // ms spent doing I/O
+}
+
+type DiskIOInfo struct {
+	Name  string `json:"name"`
+	Major int    `json:"major"`
+	Minor int    `json:"minor"`
+
+	// Filesystem is the mounted device like it is shown by df, and Mounts are where it is mounted
+	Filesystem string   `json:"filesystem"`
+	Mounts     []string `json:"mounts"`
+
+	ReadBytesPerSec  uint64  `json:"read_bytes_per_sec"`
+	WriteBytesPerSec uint64  `json:"write_bytes_per_sec"`
+	ReadIOPS         float32 `json:"read_iops"`
+	WriteIOPS        float32 `json:"write_iops"`
+	Util             float32 `json:"util_percent"` // percent of the time the device was busy
+	Await            float32 `json:"await_ms"`     // average ms for an I/O to complete
+
+	Raw DiskIORaw `json:"raw"`
+}
+
+type DiskIOSystemStat struct {
+
+	// Disks only has the devices which have done any I/O since boot
+	Disks []DiskIOInfo `json:"disks"`
+
+	prevRaw    map[string]DiskIORaw
+	prevUptime float64
+}
+
+func (f *DiskIOSystemStat) Name() string {
+	return "disk_io"
+}
+
+func (f *DiskIOSystemStat) CmdCount(sh shell.ShellType) int {
+	switch sh {
+
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+		return 3
+	}
+	return 0
+}
+
+func (f *DiskIOSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
+
+	cmds := make([]shell.ShellCmd, f.CmdCount(sh))
+
+	switch sh {
+
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+
+		cmds[0].Cmd = "cat /proc/uptime"
+		cmds[1].Cmd = "cat /proc/diskstats"
+		cmds[2].Cmd = "cat /proc/self/mountinfo"
+	}
+
+	return cmds
+}
+
+func (f *DiskIOSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
+
+	if len(outs) < 3 {
+		log.Debug().Msg("Cannot parse disk I/O, because the outputs was truncated")
+		return
+	}
+
+	uptimeParts := strings.Fields(outs[0])
+
+	if len(uptimeParts) < 1 {
+		log.Debug().Str("uptime", outs[0]).Msg("Cannot parse disk I/O, the uptime is missing")
+		return
+	}
+
+	uptime, err := strconv.ParseFloat(uptimeParts[0], 64)
+
+	if err != nil {
+		log.Debug().Err(err).Str("uptime", outs[0]).Msg("Cannot parse disk I/O, the uptime is not a number")
+		return
+	}
+
+	mounts := parseMountInfo(outs[2])
+
+	// without a previous poll the rates are the average since boot, like the first report of iostat
+	elapsed := uptime - f.prevUptime
+	prevRaw := f.prevRaw
+
+	firstPoll := elapsed <= 0 || prevRaw == nil
+
+	if firstPoll {
+		elapsed = uptime
+		prevRaw = map[string]DiskIORaw{}
+	}
+
+	raws := make(map[string]DiskIORaw)
+	f.Disks = f.Disks[:0]
+
+	scanner := bufio.NewScanner(strings.NewReader(outs[1]))
+
+	for scanner.Scan() {
+
+		fields := strings.Fields(scanner.Text())
+
+		// older kernels have 14 fields, newer ones add discard and flush counters after them
+		if len(fields) < 14 {
+			continue
+		}
+
+		disk := DiskIOInfo{Name: fields[2]}
+		disk.Major, _ = strconv.Atoi(fields[0])
+		disk.Minor, _ = strconv.Atoi(fields[1])
+
+		var counters [11]uint64
+
+		for i := range counters {
+			counters[i], _ = strconv.ParseUint(fields[3+i], 10, 64)
+		}
+
+		disk.Raw = DiskIORaw{
+			Reads:        counters[0],
+			ReadSectors:  counters[2],
+			ReadTicks:    counters[3],
+			Writes:       counters[4],
+			WriteSectors: counters[6],
+			WriteTicks:   counters[7],
+			IOTicks:      counters[9],
+		}
+
+		if disk.Raw.Reads == 0 && disk.Raw.Writes == 0 {
+			continue
+		}
+
+		raws[disk.Name] = disk.Raw
+
+		pre, ok := prevRaw[disk.Name]
+		now := disk.Raw
+
+		// a device which appeared since the last poll has no previous counters, its totals since boot
+		// over the poll interval would be a huge spike, so it has no rates until the next poll
+		if !ok && !firstPoll {
+			f.addDisk(disk, mounts)
+			continue
+		}
+
+		reads := counterDelta(pre.Reads, now.Reads)
+		writes := counterDelta(pre.Writes, now.Writes)
+
+		if elapsed > 0 {
+			disk.ReadBytesPerSec = uint64(float64(counterDelta(pre.ReadSectors, now.ReadSectors)*diskSectorSize) / elapsed)
+			disk.WriteBytesPerSec = uint64(float64(counterDelta(pre.WriteSectors, now.WriteSectors)*diskSectorSize) / elapsed)
+			disk.ReadIOPS = float32(float64(reads) / elapsed)
+			disk.WriteIOPS = float32(float64(writes) / elapsed)
+			disk.Util = min(float32(float64(counterDelta(pre.IOTicks, now.IOTicks))/(elapsed*1000)*100), 100)
+		}
+
+		if reads+writes > 0 {
+			ticks := counterDelta(pre.ReadTicks, now.ReadTicks) + counterDelta(pre.WriteTicks, now.WriteTicks)
+			disk.Await = float32(ticks) / float32(reads+writes)
+		}
+
+		f.addDisk(disk, mounts)
+	}
+
+	sort.Slice(f.Disks, func(i, j int) bool {
+
+		if f.Disks[i].Major != f.Disks[j].Major {
+			return f.Disks[i].Major < f.Disks[j].Major
+		}
+
+		return f.Disks[i].Minor < f.Disks[j].Minor
+	})
+
+	f.prevRaw = raws
+	f.prevUptime = uptime
+}
+
+// addDisk adds the disk with where it is mounted
+func (f *DiskIOSystemStat) addDisk(disk DiskIOInfo, mounts map[string]*mountInfo) {
+
+	if mount, ok := mounts[strconv.Itoa(disk.Major)+":"+strconv.Itoa(disk.Minor)]; ok {
+		disk.Filesystem = mount.source
+		disk.Mounts = mount.points
+	} else if mount, ok := mounts["/dev/"+disk.Name]; ok {
+		disk.Filesystem = mount.source
+		disk.Mounts = mount.points
+	}
+
+	f.Disks = append(f.Disks, disk)
+}
+
+// counterDelta is the difference between two counters, a counter which went backwards was reset so it counts from 0
+func counterDelta(pre, now uint64) uint64 {
+
+	if now < pre {
+		return now
+	}
+
+	return now - pre
+}
+
+type mountInfo struct {
+	source string
+	points []string
+}
+
+// parseMountInfo maps both the 'major:minor' and the source device of every mount to where it is mounted.
+// Some filesystems like btrfs report an anonymous device number, so the source is needed to find them.
+func parseMountInfo(lines string) map[string]*mountInfo {
+
+	mounts := make(map[string]*mountInfo)
+
+	scanner := bufio.NewScanner(strings.NewReader(lines))
+
+	for scanner.Scan() {
+
+		// 36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		pre, post, ok := strings.Cut(scanner.Text(), " - ")
+
+		if !ok {
+			continue
+		}
+
+		preFields := strings.Fields(pre)
+		postFields := strings.Fields(post)
+
+		if len(preFields) < 5 || len(postFields) < 2 || !strings.HasPrefix(postFields[1], "/dev/") {
+			continue
+		}
+
+		source := postFields[1]
+		point := unescapeMountPath(preFields[4])
+
+		for _, key := range []string{preFields[2], source} {
+
+			if mount, ok := mounts[key]; ok {
+				mount.points = append(mount.points, point)
+			} else {
+				mounts[key] = &mountInfo{source: source, points: []string{point}}
+			}
+		}
+	}
+
+	return mounts
+}
+
+// unescapeMountPath reverses the octal escapes like '\040' the kernel uses for spaces in mount paths
+func unescapeMountPath(s string) string {
+
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+
+		if s[i] == '\\' && i+4 <= len(s) {
+
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"mitosu/src/shell"
+	"testing"
+)
+
+const diskMountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 0:30 / /srv/data rw,relatime shared:2 - btrfs /dev/sdb rw
+24 22 0:30 /backup /backup rw,relatime shared:3 - btrfs /dev/sdb rw
+`
+
+// the 14 fields of older kernels, loop0 has done no I/O
+const diskStats = `   7       0 loop0 0 0 0 0 0 0 0 0 0 0 0
+   8       0 sda 1000 0 20000 500 2000 0 40000 1500 0 1800 2000
+   8       1 sda1 900 0 18000 450 1900 0 38000 1400 0 1700 1850
+`
+
+// sda read 100 MiB in 10 seconds, sdb is plugged in since then and has the 17 fields of newer kernels
+const diskStatsLater = `   7       0 loop0 0 0 0 0 0 0 0 0 0 0 0
+   8       0 sda 1100 0 224800 600 2100 0 40000 1600 0 2800 2200 0 0 0 0
+   8       1 sda1 1000 0 222800 550 2000 0 38000 1500 0 2700 2050
+   8      16 sdb 5000 0 900000 9000 0 0 0 0 0 4000 9000 0 0 0 0
+`
+
+func TestDiskIO(t *testing.T) {
+
+	f := &DiskIOSystemStat{}
+	f.ParseCmdOutput(shell.PosixShellType, []string{"100.00 400.00", diskStats, diskMountInfo})
+
+	if len(f.Disks) != 2 {
+		t.Fatalf("got %d disks, want sda and sda1 %+v", len(f.Disks), f.Disks)
+	}
+
+	// the first poll is the average since boot
+	if sda := f.Disks[0]; sda.Name != "sda" || sda.ReadIOPS != 10 || sda.WriteBytesPerSec != 40000*512/100 {
+		t.Errorf("sda since boot %+v", sda)
+	}
+
+	if sda1 := f.Disks[1]; sda1.Filesystem != "/dev/sda1" || len(sda1.Mounts) != 1 || sda1.Mounts[0] != "/" {
+		t.Errorf("sda1 is mounted on / %+v", sda1)
+	}
+
+	f.ParseCmdOutput(shell.PosixShellType, []string{"110.00 440.00", diskStatsLater, diskMountInfo})
+
+	if len(f.Disks) != 3 {
+		t.Fatalf("got %d disks, want sda, sda1 and sdb %+v", len(f.Disks), f.Disks)
+	}
+
+	sda := f.Disks[0]
+
+	if sda.ReadBytesPerSec != 204800*512/10 || sda.ReadIOPS != 10 || sda.WriteIOPS != 10 {
+		t.Errorf("sda rates over 10 seconds %+v", sda)
+	}
+
+	if sda.Util != 10 || sda.Await != 1 {
+		t.Errorf("sda was busy 1 of 10 seconds with 200 I/Os taking 200 ms, got util %v await %v", sda.Util, sda.Await)
+	}
+
+	sdb := f.Disks[2]
+
+	if sdb.Name != "sdb" || sdb.ReadBytesPerSec != 0 || sdb.ReadIOPS != 0 || sdb.Util != 0 || sdb.Await != 0 {
+		t.Errorf("sdb appeared since the last poll and must not have rates %+v", sdb)
+	}
+
+	if sdb.Filesystem != "/dev/sdb" || len(sdb.Mounts) != 2 {
+		t.Errorf("sdb is found by its source, its device number is anonymous %+v", sdb)
+	}
+
+	f.ParseCmdOutput(shell.PosixShellType, []string{"120.00 480.00", diskStatsLater, diskMountInfo})
+
+	if sdb := f.Disks[2]; sdb.ReadIOPS != 0 || sdb.Raw.Reads != 5000 {
+		t.Errorf("sdb did nothing since the last poll %+v", sdb)
+	}
+}
@@ -0,0 +1,413 @@
+package data
+
+import (
+	"encoding/json"
+	"mitosu/src/shell"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const DefaultDockerDiskLimit = 10
+
+// DockerDiskUsage is the disk used by one type of docker object, like a line of docker system df
+type DockerDiskUsage struct {
+	Type        string `json:"type"` // images, containers, volumes or build_cache
+	Count       int    `json:"count"`
+	Active      int    `json:"active"`
+	Size        uint64 `json:"size"`
+	Reclaimable uint64 `json:"reclaimable"`
+}
+
+// ReclaimablePerc is the percent of Size which docker system prune could free
+func (u DockerDiskUsage) ReclaimablePerc() float32 {
+
+	if u.Size == 0 {
+		return 0
+	}
+
+	return float32(float64(u.Reclaimable) / float64(u.Size) * 100)
+}
+
+type DockerImageUsage struct {
+	ID   string   `json:"id"`
+	Tags []string `json:"tags"`
+
+	// Size includes the layers shared with other images, UniqueSize does not
+	Size       uint64 `json:"size"`
+	SharedSize uint64 `json:"shared_size"`
+	UniqueSize uint64 `json:"unique_size"`
+	Containers int    `json:"containers"`
+}
+
+// ShortID is the 12 character ID docker images shows
+func (img DockerImageUsage) ShortID() string {
+
+	id := strings.TrimPrefix(img.ID, "sha256:")
+
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+type DockerVolumeUsage struct {
+	Name     string `json:"name"`
+	Driver   string `json:"driver"`
+	Size     uint64 `json:"size"`
+	RefCount int    `json:"ref_count"`
+}
+
+type DockerDiskSystemStat struct {
+	Usage []DockerDiskUsage `json:"usage"`
+
+	// Images and Volumes are the largest ones, their sizes are rounded when read from docker system df
+	Images  []DockerImageUsage  `json:"images"`
+	Volumes []DockerVolumeUsage `json:"volumes"`
+
+	// Source is "api" when read from the Docker Engine API, or "cli" when read from docker system df
+	Source string `json:"source"`
+
+	// Limit is how many of the largest images and volumes are kept
+	Limit int `json:"-"`
+}
+
+func (f *DockerDiskSystemStat) Name() string {
+	return "docker_disk"
+}
+
+func (f *DockerDiskSystemStat) CmdCount(sh shell.ShellType) int {
+	switch sh {
+
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+		return 1
+	}
+	return 0
+}
+
+// dockerDiskCmd prints how it was read on the first line, then the /system/df JSON or the docker system df lines.
+// The verbose docker system df has the images and volumes but not the totals, so both are printed.
+const dockerDiskCmd = dockerSocketCmd + `if ` + dockerAPIUpCmd + `; then
+echo api
+curl -sf --unix-socket "$s" http://localhost/system/df
+elif command -v docker >/dev/null 2>&1; then
+echo cli
+docker system df --format '{{json .}}'
+docker system df -v --format '{{json .}}'
+fi`
+
+func (f *DockerDiskSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
+
+	var cmd shell.ShellCmd
+
+	switch sh {
+	default:
+	case shell.PosixShellType:
+
+		cmd.Cmd = dockerDiskCmd
+		cmd.Stdin = nil
+	}
+
+	return []shell.ShellCmd{cmd}
+}
+
+func (f *DockerDiskSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
+
+	if len(outs) < 1 {
+		log.Debug().Msg("Cannot parse docker disk usage because no output")
+		return
+	}
+
+	f.Usage = make([]DockerDiskUsage, 0, 4)
+	f.Images = make([]DockerImageUsage, 0)
+	f.Volumes = make([]DockerVolumeUsage, 0)
+
+	source, out, _ := strings.Cut(strings.TrimLeft(outs[0], "\n"), "\n")
+	f.Source = strings.TrimSpace(source)
+
+	switch f.Source {
+	case "api":
+		f.parseAPI(out)
+	case "cli":
+		f.parseCLI(out)
+	default:
+		log.Debug().Msg("Docker is not installed")
+		f.Source = ""
+	}
+}
+
+// dockerAPIDiskUsage is the response of /system/df, sizes are -1 when docker has not worked them out
+type dockerAPIDiskUsage struct {
+	LayersSize int64 `json:"LayersSize"`
+	Images     []struct {
+		ID         string   `json:"Id"`
+		RepoTags   []string `json:"RepoTags"`
+		Size       int64    `json:"Size"`
+		SharedSize int64    `json:"SharedSize"`
+		Containers int      `json:"Containers"`
+	} `json:"Images"`
+	Containers []struct {
+		SizeRw int64  `json:"SizeRw"`
+		State  string `json:"State"`
+	} `json:"Containers"`
+	Volumes []struct {
+		Name      string `json:"Name"`
+		Driver    string `json:"Driver"`
+		UsageData *struct {
+			Size     int64 `json:"Size"`
+			RefCount int   `json:"RefCount"`
+		} `json:"UsageData"`
+	} `json:"Volumes"`
+	BuildCache []struct {
+		Size   int64 `json:"Size"`
+		InUse  bool  `json:"InUse"`
+		Shared bool  `json:"Shared"`
+	} `json:"BuildCache"`
+}
+
+// knownSize is 0 for the unknown size -1
+func knownSize(n int64) uint64 {
+	return uint64(max(n, 0))
+}
+
+// parseAPI works out the totals and reclaimable sizes the same way docker system df does
+func (f *DockerDiskSystemStat) parseAPI(out string) {
+
+	var df dockerAPIDiskUsage
+
+	if err := json.Unmarshal([]byte(out), &df); err != nil {
+		log.Debug().Err(err).Msg("failed to parse docker disk usage")
+		return
+	}
+
+	images := DockerDiskUsage{Type: "images", Count: len(df.Images), Size: knownSize(df.LayersSize)}
+	var imagesUsed uint64
+
+	for _, img := range df.Images {
+
+		usage := DockerImageUsage{
+			ID:         img.ID,
+			Tags:       img.RepoTags,
+			Size:       knownSize(img.Size),
+			SharedSize: knownSize(img.SharedSize),
+			Containers: img.Containers,
+		}
+		usage.UniqueSize = usage.Size - min(usage.SharedSize, usage.Size)
+
+		if img.Containers > 0 {
+			images.Active++
+			imagesUsed += usage.UniqueSize
+		}
+
+		f.Images = append(f.Images, usage)
+	}
+
+	images.Reclaimable = images.Size - min(imagesUsed, images.Size)
+
+	containers := DockerDiskUsage{Type: "containers", Count: len(df.Containers)}
+
+	for _, c := range df.Containers {
+
+		containers.Size += knownSize(c.SizeRw)
+
+		if c.State == "running" {
+			containers.Active++
+		} else {
+			containers.Reclaimable += knownSize(c.SizeRw)
+		}
+	}
+
+	volumes := DockerDiskUsage{Type: "volumes", Count: len(df.Volumes)}
+
+	for _, v := range df.Volumes {
+
+		usage := DockerVolumeUsage{Name: v.Name, Driver: v.Driver}
+
+		if v.UsageData != nil {
+			usage.Size = knownSize(v.UsageData.Size)
+			usage.RefCount = v.UsageData.RefCount
+		}
+
+		volumes.Size += usage.Size
+
+		if usage.RefCount > 0 {
+			volumes.Active++
+		} else {
+			volumes.Reclaimable += usage.Size
+		}
+
+		f.Volumes = append(f.Volumes, usage)
+	}
+
+	cache := DockerDiskUsage{Type: "build_cache", Count: len(df.BuildCache)}
+
+	for _, b := range df.BuildCache {
+
+		if b.InUse {
+			cache.Active++
+		}
+
+		// shared records are counted in the records they are shared with
+		if b.Shared {
+			continue
+		}
+
+		cache.Size += knownSize(b.Size)
+
+		if !b.InUse {
+			cache.Reclaimable += knownSize(b.Size)
+		}
+	}
+
+	f.Usage = append(f.Usage, images, containers, volumes, cache)
+
+	f.keepLargest()
+}
+
+// keepLargest sorts the images and volumes by size and keeps the Limit largest
+func (f *DockerDiskSystemStat) keepLargest() {
+
+	sort.SliceStable(f.Images, func(i, j int) bool { return f.Images[i].Size > f.Images[j].Size })
+	sort.SliceStable(f.Volumes, func(i, j int) bool { return f.Volumes[i].Size > f.Volumes[j].Size })
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultDockerDiskLimit
+	}
+
+	f.Images = f.Images[:min(limit, len(f.Images))]
+	f.Volumes = f.Volumes[:min(limit, len(f.Volumes))]
+}
+
+// dockerCLIUsageTypes maps the types docker system df shows to the types of the API
+var dockerCLIUsageTypes = map[string]string{
+	"Images":        "images",
+	"Containers":    "containers",
+	"Local Volumes": "volumes",
+	"Build Cache":   "build_cache",
+}
+
+// dockerCLIDiskUsage is a line of docker system df, which is a total like
+// {"Active":"2","Reclaimable":"1.2GB (50%)","Size":"2.4GB","TotalCount":"5","Type":"Images"},
+// or the images and volumes of the verbose docker system df. Numbers are N/A when docker does not know them.
+type dockerCLIDiskUsage struct {
+	Type        string
+	TotalCount  string
+	Active      string
+	Size        string
+	Reclaimable string
+
+	Images []struct {
+		ID         string
+		Repository string
+		Tag        string
+		Size       string
+		SharedSize string
+		UniqueSize string
+		Containers string
+	}
+	Volumes []struct {
+		Name   string
+		Driver string
+		Size   string
+		Links  string
+	}
+}
+
+// parseCLI parses the totals of docker system df, then the images and volumes of the verbose one
+func (f *DockerDiskSystemStat) parseCLI(out string) {
+
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+
+		if line == "" {
+			continue
+		}
+
+		var row dockerCLIDiskUsage
+
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			log.Debug().Err(err).Str("line", line).Msg("failed to parse docker system df line")
+			continue
+		}
+
+		if row.Type == "" {
+			f.parseCLIVerbose(row)
+			continue
+		}
+
+		usage := DockerDiskUsage{Type: dockerCLIUsageTypes[row.Type]}
+
+		if usage.Type == "" {
+			usage.Type = strings.ToLower(strings.ReplaceAll(row.Type, " ", "_"))
+		}
+
+		usage.Count, _ = strconv.Atoi(row.TotalCount)
+		usage.Active, _ = strconv.Atoi(row.Active)
+
+		if n, err := parseMemory(row.Size); err == nil {
+			usage.Size = n
+		} else {
+			log.Debug().Err(err).Msg("failed to parse docker disk usage size")
+		}
+
+		// the reclaimable size is followed by its percent
+		if fields := strings.Fields(row.Reclaimable); len(fields) > 0 {
+
+			if n, err := parseMemory(fields[0]); err == nil {
+				usage.Reclaimable = n
+			} else {
+				log.Debug().Err(err).Msg("failed to parse docker disk usage reclaimable")
+			}
+		}
+
+		f.Usage = append(f.Usage, usage)
+	}
+
+	f.keepLargest()
+}
+
+// parseCLIVerbose adds the images and volumes of the verbose docker system df, whose sizes are rounded like 187MB
+func (f *DockerDiskSystemStat) parseCLIVerbose(row dockerCLIDiskUsage) {
+
+	for _, img := range row.Images {
+
+		usage := DockerImageUsage{ID: img.ID, Tags: make([]string, 0), Containers: cliCount(img.Containers)}
+
+		// dangling images have no repository or tag
+		if img.Repository != "<none>" && img.Tag != "<none>" {
+			usage.Tags = append(usage.Tags, img.Repository+":"+img.Tag)
+		}
+
+		usage.Size, _ = parseMemory(img.Size)
+		usage.SharedSize, _ = parseMemory(img.SharedSize)
+		usage.UniqueSize, _ = parseMemory(img.UniqueSize)
+
+		f.Images = append(f.Images, usage)
+	}
+
+	for _, v := range row.Volumes {
+
+		usage := DockerVolumeUsage{Name: v.Name, Driver: v.Driver, RefCount: cliCount(v.Links)}
+		usage.Size, _ = parseMemory(v.Size)
+
+		f.Volumes = append(f.Volumes, usage)
+	}
+}
+
+// cliCount is -1 for the N/A docker shows when it does not know the count
+func cliCount(s string) int {
+
+	n, err := strconv.Atoi(s)
+
+	if err != nil {
+		return -1
+	}
+
+	return n
+}
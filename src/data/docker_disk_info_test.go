@@ -0,0 +1,44 @@
+package data
+
+import (
+	"mitosu/src/shell"
+	"testing"
+)
+
+const dockerSystemDf = `cli
+{"Active":"2","Reclaimable":"1.2GB (50%)","Size":"2.4GB","TotalCount":"5","Type":"Images"}
+{"Active":"1","Reclaimable":"0B (0%)","Size":"12kB","TotalCount":"1","Type":"Containers"}
+{"Active":"0","Reclaimable":"3.1GB (100%)","Size":"3.1GB","TotalCount":"2","Type":"Local Volumes"}
+{"Active":"0","Reclaimable":"0B","Size":"0B","TotalCount":"0","Type":"Build Cache"}
+{"BuildCache":[],"Containers":[{"ID":"abcdef123456","Image":"nginx","Size":"12kB (virtual 187MB)","State":"running"}],"Images":[{"Containers":"1","Digest":"<none>","ID":"sha256:1111111111111111111111111111111111111111111111111111111111111111","Repository":"nginx","SharedSize":"7.5MB","Size":"187MB","Tag":"latest","UniqueSize":"179.5MB"},{"Containers":"N/A","Digest":"<none>","ID":"sha256:2222222222222222222222222222222222222222222222222222222222222222","Repository":"<none>","SharedSize":"N/A","Size":"2.2GB","Tag":"<none>","UniqueSize":"N/A"},{"Containers":"0","Digest":"<none>","ID":"sha256:3333333333333333333333333333333333333333333333333333333333333333","Repository":"busybox","SharedSize":"0B","Size":"4.3MB","Tag":"1.36","UniqueSize":"4.3MB"}],"Volumes":[{"Driver":"local","Links":"0","Name":"old","Size":"N/A"},{"Driver":"local","Links":"1","Name":"pgdata","Size":"3.1GB"}]}
+`
+
+func TestDockerDiskCLI(t *testing.T) {
+
+	f := &DockerDiskSystemStat{Limit: 2}
+	f.ParseCmdOutput(shell.PosixShellType, []string{dockerSystemDf})
+
+	if f.Source != "cli" || len(f.Usage) != 4 {
+		t.Fatalf("got %s %+v", f.Source, f.Usage)
+	}
+
+	if u := f.Usage[2]; u.Type != "volumes" || u.Count != 2 || u.Size != 3_100_000_000 || u.Reclaimable != 3_100_000_000 {
+		t.Errorf("volumes usage %+v", u)
+	}
+
+	if len(f.Images) != 2 {
+		t.Fatalf("got %d images, want the 2 largest %+v", len(f.Images), f.Images)
+	}
+
+	if img := f.Images[0]; img.ShortID() != "222222222222" || len(img.Tags) != 0 || img.Size != 2_200_000_000 || img.Containers != -1 {
+		t.Errorf("the dangling image %+v", img)
+	}
+
+	if img := f.Images[1]; len(img.Tags) != 1 || img.Tags[0] != "nginx:latest" || img.UniqueSize != 179_500_000 || img.Containers != 1 {
+		t.Errorf("the nginx image %+v", img)
+	}
+
+	if len(f.Volumes) != 2 || f.Volumes[0].Name != "pgdata" || f.Volumes[0].RefCount != 1 || f.Volumes[1].Size != 0 {
+		t.Errorf("volumes %+v", f.Volumes)
+	}
+}
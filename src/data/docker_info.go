@@ -1,31 +1,92 @@
 package data
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"mitosu/src/shell"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 type DockerContainer struct {
-	ID       string
-	Name     string
-	CPU      string
-	MemUsed  uint64
-	MemTotal uint64
-
-	MemPerc  string
-	NetIn    uint64
-	NetOut   uint64
-	BlockIn  uint64
-	BlockOut uint64
-	PIDs     uint64
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Runtime  string  `json:"runtime"` // docker, podman, nerdctl or crictl
+	CPU      float32 `json:"cpu_percent"`
+	MemUsed  uint64  `json:"mem_used"`
+	MemTotal uint64  `json:"mem_total"`
+
+	MemPerc  float32 `json:"mem_percent"`
+	NetIn    uint64  `json:"net_in"`
+	NetOut   uint64  `json:"net_out"`
+	BlockIn  uint64  `json:"block_in"`
+	BlockOut uint64  `json:"block_out"`
+	PIDs     uint64  `json:"pids"`
+
+	Image    string `json:"image"`
+	State    string `json:"state"`
+	Status   string `json:"status"`
+	Health   string `json:"health"`
+	ExitCode int    `json:"exit_code"`
+
+	// these are only known from the Docker Engine API and crictl
+	RestartCount  int               `json:"restart_count"`
+	StartedAt     time.Time         `json:"started_at,omitzero"`
+	FinishedAt    time.Time         `json:"finished_at,omitzero"`
+	UptimeSeconds float64           `json:"uptime_seconds"`
+	Labels        map[string]string `json:"labels"`
 }
 
 type DockerSystemStat struct {
-	DockerContainers []DockerContainer
+	DockerContainers []DockerContainer `json:"containers"`
+
+	// Source is "api" when the stats came from the Docker Engine API, or "cli" when they were parsed from the
+	// output of the container runtime's CLI, it is empty when no runtime was found
+	Source string `json:"source"`
+}
+
+// ShortID is the 12 character ID docker shows
+func (c DockerContainer) ShortID() string {
+
+	if len(c.ID) > 12 {
+		return c.ID[:12]
+	}
+
+	return c.ID
+}
+
+// Running is true for running containers, and when the state is not known
+func (c DockerContainer) Running() bool {
+	return c.State == "" || c.State == "running"
+}
+
+// Problem is true for containers which stopped, are restarting or fail their health check
+func (c DockerContainer) Problem() bool {
+
+	switch c.State {
+	case "exited", "dead", "restarting":
+		return true
+	}
+
+	return c.Health == "unhealthy"
+}
+
+// Since is when the container started, or stopped when it is not running, it is zero when not known
+func (c DockerContainer) Since() time.Time {
+
+	if !c.Running() {
+		return c.FinishedAt
+	}
+
+	return c.StartedAt
+}
+
+func (f *DockerSystemStat) Name() string {
+	return "docker"
 }
 
 func (f *DockerSystemStat) CmdCount(sh shell.ShellType) int {
@@ -39,6 +100,49 @@ func (f *DockerSystemStat) CmdCount(sh shell.ShellType) int {
 	}
 	return 0
 }
+
+// dockerSocketCmd sets $s to the Docker socket, the rootless one when the system one is missing
+const dockerSocketCmd = `s=/var/run/docker.sock
+[ -S "$s" ] || s="${XDG_RUNTIME_DIR:-/nonexistent}/docker.sock"
+`
+
+// dockerAPIUpCmd succeeds when the Docker Engine API can be used through $s with curl
+const dockerAPIUpCmd = `[ -S "$s" ] && command -v curl >/dev/null 2>&1 && curl -sf --unix-socket "$s" http://localhost/_ping >/dev/null 2>&1`
+
+// containersCmd uses the first container runtime it finds, and prints its name and how it was read on the first line.
+// The Docker Engine API gets all containers, then inspects and gets the stats of each in parallel, because
+// getting stats waits for a second sample to work out the CPU usage. Every response is printed after the list.
+// The trap removes the temporary directory of the responses however the command exits.
+// The docker, podman and nerdctl CLIs print ps lines then the stats, crictl prints its JSON.
+const containersCmd = dockerSocketCmd + `if ` + dockerAPIUpCmd + `; then
+echo docker api
+d=$(mktemp -d) || exit
+trap 'rm -rf "$d"' EXIT
+curl -sf --unix-socket "$s" "http://localhost/containers/json?all=1" > "$d/list"
+for id in $(grep -o '"Id": *"[0-9a-f]*"' "$d/list" | cut -d'"' -f4); do
+curl -sf --unix-socket "$s" "http://localhost/containers/$id/json" > "$d/$id.inspect" &
+curl -sf --unix-socket "$s" "http://localhost/containers/$id/stats?stream=false" > "$d/$id.stats" &
+done
+wait
+cat "$d/list" "$d"/*.inspect "$d"/*.stats 2>/dev/null
+elif command -v docker >/dev/null 2>&1; then
+echo docker cli
+docker ps -a --no-trunc --format '{{.ID}}|{{.Names}}|{{.Image}}|{{.State}}|{{.Status}}' | sed 's/^/ps|/'
+docker stats --no-stream --format "{{.Container}}\n{{.Name}}\n{{.CPUPerc}}\n{{.MemUsage}}\n{{.MemPerc}}\n{{.NetIO}}\n{{.BlockIO}}\n{{.PIDs}}"
+elif command -v podman >/dev/null 2>&1; then
+echo podman cli
+podman ps -a --no-trunc --format '{{.ID}}|{{.Names}}|{{.Image}}|{{.State}}|{{.Status}}' | sed 's/^/ps|/'
+podman stats --no-stream --format "{{.ID}}\n{{.Name}}\n{{.CPUPerc}}\n{{.MemUsage}}\n{{.MemPerc}}\n{{.NetIO}}\n{{.BlockIO}}\n{{.PIDS}}"
+elif command -v nerdctl >/dev/null 2>&1; then
+echo nerdctl cli
+nerdctl ps -a --no-trunc --format '{{.ID}}|{{.Names}}|{{.Image}}||{{.Status}}' | sed 's/^/ps|/'
+nerdctl stats --no-stream --format "{{.ID}}\n{{.Name}}\n{{.CPUPerc}}\n{{.MemUsage}}\n{{.MemPerc}}\n{{.NetIO}}\n{{.BlockIO}}\n{{.PIDs}}"
+elif command -v crictl >/dev/null 2>&1; then
+echo crictl cli
+crictl ps -a -o json
+crictl stats -o json
+fi`
+
 func (f *DockerSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
 
 	var cmd shell.ShellCmd
@@ -47,16 +151,7 @@ func (f *DockerSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
 	default:
 	case shell.PosixShellType:
 
-		cmd.Cmd = `docker stats --no-stream --format "` +
-			`{{.Container}}\n` +
-			`{{.Name}}\n` +
-			`{{.CPUPerc}}\n` +
-			`{{.MemUsage}}\n` +
-			`{{.MemPerc}}\n` +
-			`{{.NetIO}}\n` +
-			`{{.BlockIO}}\n` +
-			`{{.PIDs}}` +
-			`"`
+		cmd.Cmd = containersCmd
 		cmd.Stdin = nil
 	}
 
@@ -76,19 +171,263 @@ func (f *DockerSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
 		f.DockerContainers = f.DockerContainers[:0]
 	}
 
-	linesArr := strings.Split(strings.TrimSpace(outs[0]), "\n")
+	// the first line is like "podman cli", it is missing when no runtime was found
+	header, out, _ := strings.Cut(strings.TrimLeft(outs[0], "\n"), "\n")
+	runtime, source, _ := strings.Cut(header, " ")
+
+	f.Source = source
+
+	switch {
+	case source == "api":
+		f.parseAPI(out)
+	case runtime == "crictl":
+		f.parseCRI(out)
+	case source == "cli":
+		f.parseCLI(out)
+	default:
+		log.Debug().Str("header", header).Msg("No container runtime found")
+		f.Source = ""
+		return
+	}
+
+	for i := range f.DockerContainers {
+		f.DockerContainers[i].Runtime = runtime
+	}
+}
+
+// dockerAPIContainer is a container in the list from /containers/json
+type dockerAPIContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	State  string            `json:"State"`
+	Status string            `json:"Status"`
+	Labels map[string]string `json:"Labels"`
+}
+
+type dockerAPICPUStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  uint64 `json:"online_cpus"`
+}
+
+// dockerAPIDoc is either the inspect of a container from /containers/{id}/json, which has Id,
+// or its stats from /containers/{id}/stats, which has id
+type dockerAPIDoc struct {
+	ID           string `json:"Id"`
+	RestartCount int    `json:"RestartCount"`
+	State        *struct {
+		StartedAt  time.Time `json:"StartedAt"`
+		FinishedAt time.Time `json:"FinishedAt"`
+		ExitCode   int       `json:"ExitCode"`
+		Health     *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+
+	StatsID     string            `json:"id"`
+	CPUStats    dockerAPICPUStats `json:"cpu_stats"`
+	PreCPUStats dockerAPICPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+// parseAPI parses the container list followed by the inspect and stats of each container
+func (f *DockerSystemStat) parseAPI(out string) {
+
+	dec := json.NewDecoder(strings.NewReader(out))
+
+	var list []dockerAPIContainer
+
+	if err := dec.Decode(&list); err != nil {
+		log.Debug().Err(err).Msg("failed to parse docker container list")
+		return
+	}
+
+	index := make(map[string]int, len(list))
+
+	for _, c := range list {
+
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		index[c.ID] = len(f.DockerContainers)
+
+		f.DockerContainers = append(f.DockerContainers, DockerContainer{
+			ID:     c.ID,
+			Name:   name,
+			Image:  c.Image,
+			State:  c.State,
+			Status: c.Status,
+			Labels: c.Labels,
+		})
+	}
+
+	now := time.Now()
+
+	for dec.More() {
+
+		var doc dockerAPIDoc
+
+		if err := dec.Decode(&doc); err != nil {
+			log.Debug().Err(err).Msg("failed to parse docker container inspect or stats")
+			return
+		}
+
+		if i, ok := index[doc.ID]; ok && doc.State != nil {
+
+			container := &f.DockerContainers[i]
+			container.RestartCount = doc.RestartCount
+			container.ExitCode = doc.State.ExitCode
+
+			if doc.State.Health != nil {
+				container.Health = doc.State.Health.Status
+			}
+
+			if !doc.State.StartedAt.IsZero() {
+				container.StartedAt = doc.State.StartedAt
+
+				if container.Running() {
+					container.UptimeSeconds = now.Sub(doc.State.StartedAt).Seconds()
+				}
+			}
+
+			// docker uses the zero time for containers which never stopped
+			if !doc.State.FinishedAt.IsZero() {
+				container.FinishedAt = doc.State.FinishedAt
+			}
+
+		} else if i, ok := index[doc.StatsID]; ok {
+			doc.setStats(&f.DockerContainers[i])
+		}
+	}
+}
+
+// setStats works out the stats the same way docker stats does
+func (doc *dockerAPIDoc) setStats(container *DockerContainer) {
+
+	cpus := doc.CPUStats.OnlineCPUs
+	if cpus == 0 {
+		cpus = uint64(len(doc.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	cpuDelta := counterDelta(doc.PreCPUStats.CPUUsage.TotalUsage, doc.CPUStats.CPUUsage.TotalUsage)
+	systemDelta := counterDelta(doc.PreCPUStats.SystemUsage, doc.CPUStats.SystemUsage)
+
+	if systemDelta > 0 && doc.PreCPUStats.CPUUsage.TotalUsage > 0 {
+		container.CPU = float32(float64(cpuDelta) / float64(systemDelta) * float64(cpus) * 100)
+	}
+
+	// the page cache is not counted as used, it is total_inactive_file with cgroup v1 and inactive_file with v2
+	container.MemUsed = doc.MemoryStats.Usage
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+
+		if cache, ok := doc.MemoryStats.Stats[key]; ok && cache < container.MemUsed {
+			container.MemUsed -= cache
+			break
+		}
+	}
+
+	container.MemTotal = doc.MemoryStats.Limit
+	if container.MemTotal > 0 {
+		container.MemPerc = float32(float64(container.MemUsed) / float64(container.MemTotal) * 100)
+	}
+
+	for _, n := range doc.Networks {
+		container.NetIn += n.RxBytes
+		container.NetOut += n.TxBytes
+	}
+
+	for _, b := range doc.BlkioStats.IOServiceBytesRecursive {
+
+		switch strings.ToLower(b.Op) {
+		case "read":
+			container.BlockIn += b.Value
+		case "write":
+			container.BlockOut += b.Value
+		}
+	}
+
+	container.PIDs = doc.PidsStats.Current
+}
+
+// parseCLI parses the output of docker ps, one line for each container starting with ps|,
+// followed by the output of docker stats, 8 lines for each running container.
+// podman and nerdctl print the same.
+func (f *DockerSystemStat) parseCLI(out string) {
+
+	index := make(map[string]int)
+	linesArr := make([]string, 0)
+
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+
+		if !strings.HasPrefix(line, "ps|") {
+			linesArr = append(linesArr, line)
+			continue
+		}
+
+		// ps|ID|Names|Image|State|Status
+		fields := strings.SplitN(line, "|", 6)
+
+		if len(fields) < 6 {
+			log.Debug().Str("line", line).Msg("failed to parse docker ps line")
+			continue
+		}
+
+		container := DockerContainer{
+			ID:     fields[1],
+			Name:   fields[2],
+			Image:  fields[3],
+			State:  fields[4],
+			Status: fields[5],
+		}
+		container.ExitCode, container.Health = parseDockerStatus(container.Status)
+
+		// nerdctl has no state, and older podman shows it differently
+		if state := stateFromStatus(container.Status); state != "" {
+			if _, known := containerStates[container.State]; !known {
+				container.State = state
+			}
+		}
+
+		index[container.Name] = len(f.DockerContainers)
+		f.DockerContainers = append(f.DockerContainers, container)
+	}
 
 	const fields = 8
 
 	for i := 0; i+fields <= len(linesArr); i += fields {
 
-		container := DockerContainer{
-			ID:      linesArr[i],
-			Name:    linesArr[i+1],
-			CPU:     linesArr[i+2],
-			MemPerc: linesArr[i+4],
+		container := &DockerContainer{ID: linesArr[i], Name: linesArr[i+1]}
+
+		if j, ok := index[container.Name]; ok {
+			container = &f.DockerContainers[j]
 		}
 
+		container.CPU = parsePercent(linesArr[i+2])
+		container.MemPerc = parsePercent(linesArr[i+4])
+
 		// memory used / total
 		if mem := strings.Split(linesArr[i+3], "/"); len(mem) == 2 {
 
@@ -144,8 +483,72 @@ func (f *DockerSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
 			log.Debug().Err(err).Msg("failed to parse docker container PIDs")
 		}
 
-		f.DockerContainers = append(f.DockerContainers, container)
+		if _, ok := index[container.Name]; !ok {
+			f.DockerContainers = append(f.DockerContainers, *container)
+		}
+	}
+}
+
+// containerStates are the states the Docker Engine API uses, which the other runtimes are mapped to
+var containerStates = map[string]struct{}{
+	"created":    {},
+	"running":    {},
+	"paused":     {},
+	"restarting": {},
+	"removing":   {},
+	"exited":     {},
+	"dead":       {},
+}
+
+// stateFromStatus gets the state from the start of a status like "Up 3 hours" or "Exited (0) 2 days ago"
+func stateFromStatus(status string) string {
+
+	switch {
+	case strings.Contains(status, "(Paused)"):
+		return "paused"
+	case strings.HasPrefix(status, "Up"):
+		return "running"
+	case strings.HasPrefix(status, "Exited"):
+		return "exited"
+	case strings.HasPrefix(status, "Created"):
+		return "created"
+	case strings.HasPrefix(status, "Restarting"):
+		return "restarting"
+	case strings.HasPrefix(status, "Removal"):
+		return "removing"
+	case strings.HasPrefix(status, "Dead"):
+		return "dead"
+	}
+
+	return ""
+}
+
+// parseDockerStatus gets the exit code and health from the status docker ps shows,
+// like "Exited (137) 2 hours ago" or "Up 3 hours (unhealthy)"
+func parseDockerStatus(status string) (int, string) {
+
+	exitCode := 0
+	health := ""
+
+	if strings.HasPrefix(status, "Exited (") {
+
+		code, _, _ := strings.Cut(strings.TrimPrefix(status, "Exited ("), ")")
+
+		if n, err := strconv.Atoi(code); err == nil {
+			exitCode = n
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(status, "(unhealthy)"):
+		health = "unhealthy"
+	case strings.HasSuffix(status, "(healthy)"):
+		health = "healthy"
+	case strings.HasSuffix(status, "(health: starting)"):
+		health = "starting"
 	}
+
+	return exitCode, health
 }
 
 func parseMemory(s string) (uint64, error) {
@@ -159,15 +562,41 @@ func parseMemory(s string) (uint64, error) {
 
 	log.Debug().Str("raw", s).Str("unit", unit).Float64("val", value).Msg("docker parsing memory value")
 
+	// docker shows memory in binary units like MiB and io in decimal units like kB and MB
+	base := 1000.0
+	if strings.Contains(unit, "i") {
+		base = 1024
+	}
+
+	multiplier := 1.0
+
 	switch strings.ToLower(unit)[0] {
 	case 'b':
-		return uint64(value), nil
 	case 'k':
-		return uint64(value * 1024), nil
+		multiplier = base
 	case 'm':
-		return uint64(value * 1024 * 1024), nil
+		multiplier = math.Pow(base, 2)
 	case 'g':
-		return uint64(value * 1024 * 1024 * 1024), nil
+		multiplier = math.Pow(base, 3)
+	case 't':
+		multiplier = math.Pow(base, 4)
+	case 'p':
+		multiplier = math.Pow(base, 5)
+	default:
+		return 0, fmt.Errorf("unknown unit: %s", unit)
+	}
+
+	return uint64(value * multiplier), nil
+}
+
+// parsePercent parses a value like "1.23%", returning 0 when docker shows "--" for a stopped container
+func parsePercent(s string) float32 {
+
+	p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 32)
+
+	if err != nil {
+		return 0
 	}
-	return 0, fmt.Errorf("unknown unit: %s", unit)
+
+	return float32(p)
 }
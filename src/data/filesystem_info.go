@@ -33,16 +33,25 @@ func (f FSType) String() string {
 	return ""
 }
 
+// MarshalText writes the type as a lowercase name like "local" in the JSON output
+func (f FSType) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(f.String())), nil
+}
+
 type FSInfo struct {
-	Type       FSType
-	Filesystem string
-	MountPoint string
-	Used       uint64
-	Free       uint64
+	Type       FSType `json:"type"`
+	Filesystem string `json:"filesystem"`
+	MountPoint string `json:"mount_point"`
+	Used       uint64 `json:"used"`
+	Free       uint64 `json:"free"`
 }
 
 type FSSystemStat struct {
-	FSInfos []FSInfo
+	FSInfos []FSInfo `json:"filesystems"`
+}
+
+func (f *FSSystemStat) Name() string {
+	return "filesystems"
 }
 
 func (f *FSSystemStat) CmdCount(sh shell.ShellType) int {
@@ -0,0 +1,321 @@
+package data
+
+import (
+	"bufio"
+	"mitosu/src/shell"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// InventorySystemStat is what the host is, it is only collected once per connection
+type InventorySystemStat struct {
+	Hostname string `json:"hostname"`
+
+	// OSName is like "Ubuntu 24.04.1 LTS", OSID is like ubuntu and OSVersion like 24.04
+	OSName    string `json:"os_name"`
+	OSID      string `json:"os_id"`
+	OSVersion string `json:"os_version"`
+
+	Kernel        string `json:"kernel"` // the release like 6.8.0-45-generic
+	KernelVersion string `json:"kernel_version"`
+	Arch          string `json:"arch"`
+	Uname         string `json:"uname"` // all of uname -a
+
+	CPUModel   string `json:"cpu_model"`
+	CPUSockets int    `json:"cpu_sockets"`
+	CPUCores   int    `json:"cpu_cores"`
+	CPUThreads int    `json:"cpu_threads"`
+
+	MemTotal uint64 `json:"mem_total"`
+
+	// Virtualization is like kvm, vmware or docker, it is none on bare metal and empty when not known
+	Virtualization string `json:"virtualization"`
+
+	// Vendor and Product are of the machine from DMI, they are empty when there is no DMI like on most ARM boards
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+
+	BootTime time.Time `json:"boot_time"`
+
+	// Timezone is like Europe/Berlin, empty when not known, UTCOffset is like +0200
+	Timezone  string `json:"timezone"`
+	UTCOffset string `json:"utc_offset"`
+
+	collected bool
+}
+
+// Reset makes the inventory collected again, like after connecting again to a host which was rebooted
+func (f *InventorySystemStat) Reset() {
+	f.collected = false
+}
+
+func (f *InventorySystemStat) Name() string {
+	return "inventory"
+}
+
+func (f *InventorySystemStat) CmdCount(sh shell.ShellType) int {
+	switch sh {
+
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+
+		// nothing to run once collected
+		if f.collected {
+			return 0
+		}
+
+		return 7
+	}
+	return 0
+}
+
+func (f *InventorySystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
+
+	cmds := make([]shell.ShellCmd, f.CmdCount(sh))
+
+	if len(cmds) == 0 {
+		return cmds
+	}
+
+	switch sh {
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+
+		cmds[0].Cmd = "cat /etc/os-release 2>/dev/null || cat /usr/lib/os-release"
+		cmds[1].Cmd = "uname -a; uname -n; uname -r; uname -v; uname -m"
+
+		// processor is on every line of a CPU, the model is model name on x86 and Model or Hardware on ARM
+		cmds[2].Cmd = "grep -E '^(processor|model name|Model|Hardware|physical id|core id)[[:space:]]*:' /proc/cpuinfo"
+
+		cmds[3].Cmd = "grep MemTotal /proc/meminfo"
+
+		// systemd-detect-virt prints none on bare metal, the DMI vendor is used without it
+		cmds[4].Cmd = "echo \"virt $(systemd-detect-virt 2>/dev/null)\"; grep -H . /sys/class/dmi/id/sys_vendor /sys/class/dmi/id/product_name 2>/dev/null"
+
+		cmds[5].Cmd = "grep btime /proc/stat"
+
+		// the timezone is not in a single place on every distribution
+		cmds[6].Cmd = "date +%z; cat /etc/timezone 2>/dev/null || readlink /etc/localtime"
+	}
+
+	return cmds
+}
+
+func (f *InventorySystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
+
+	if f.collected {
+		return
+	}
+
+	if len(outs) < 7 {
+		log.Debug().Msg("Cannot parse inventory because no output")
+		return
+	}
+
+	f.parseOSRelease(outs[0])
+	f.parseUname(outs[1])
+	f.parseCPUInfo(outs[2])
+
+	if fields := strings.Fields(outs[3]); len(fields) >= 2 {
+		if kb, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			f.MemTotal = kb * 1024
+		}
+	}
+
+	f.parseVirt(outs[4])
+
+	if fields := strings.Fields(outs[5]); len(fields) >= 2 {
+		if btime, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			f.BootTime = time.Unix(btime, 0).UTC()
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(outs[6]), "\n")
+
+	f.UTCOffset = strings.TrimSpace(lines[0])
+	f.Timezone = ""
+
+	if len(lines) > 1 {
+
+		// the link is like /usr/share/zoneinfo/Europe/Berlin
+		tz := strings.TrimSpace(lines[1])
+
+		if _, name, ok := strings.Cut(tz, "zoneinfo/"); ok {
+			tz = name
+		}
+
+		f.Timezone = tz
+	}
+
+	f.collected = true
+}
+
+// parseOSRelease parses lines like PRETTY_NAME="Ubuntu 24.04.1 LTS"
+func (f *InventorySystemStat) parseOSRelease(out string) {
+
+	release := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+
+		if !ok {
+			continue
+		}
+
+		release[key] = strings.Trim(value, `"'`)
+	}
+
+	f.OSName = release["PRETTY_NAME"]
+	if f.OSName == "" {
+		f.OSName = strings.TrimSpace(release["NAME"] + " " + release["VERSION"])
+	}
+
+	f.OSID = release["ID"]
+	f.OSVersion = release["VERSION_ID"]
+}
+
+// parseUname parses uname -a, followed by the node name, release, version and machine on their own lines
+func (f *InventorySystemStat) parseUname(out string) {
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+
+	if len(lines) < 5 {
+		log.Debug().Int("lines", len(lines)).Msg("failed to parse uname")
+		return
+	}
+
+	f.Uname = strings.TrimSpace(lines[0])
+	f.Hostname = strings.TrimSpace(lines[1])
+	f.Kernel = strings.TrimSpace(lines[2])
+	f.KernelVersion = strings.TrimSpace(lines[3])
+	f.Arch = strings.TrimSpace(lines[4])
+}
+
+// parseCPUInfo counts the threads, the cores by their physical id and core id, and the sockets by their physical id
+func (f *InventorySystemStat) parseCPUInfo(out string) {
+
+	f.CPUModel = ""
+	f.CPUThreads = 0
+
+	var model, board, physical string
+
+	cores := make(map[string]bool)
+	sockets := make(map[string]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+
+		if !ok {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "processor":
+			f.CPUThreads++
+		case "model name":
+			model = value
+		case "Model", "Hardware":
+			board = value
+		case "physical id":
+			physical = value
+			sockets[value] = true
+		case "core id":
+			cores[physical+" "+value] = true
+		}
+	}
+
+	f.CPUModel = model
+	if f.CPUModel == "" {
+		f.CPUModel = board
+	}
+
+	// ARM has no physical id or core id, every thread is a core
+	f.CPUCores = len(cores)
+	if f.CPUCores == 0 {
+		f.CPUCores = f.CPUThreads
+	}
+
+	f.CPUSockets = len(sockets)
+	if f.CPUSockets == 0 && f.CPUThreads > 0 {
+		f.CPUSockets = 1
+	}
+}
+
+// dmiVirt are the DMI vendors and products of virtual machines, named like systemd-detect-virt does
+var dmiVirt = []struct {
+	match string
+	virt  string
+}{
+	{"KVM", "kvm"},
+	{"QEMU", "qemu"},
+	{"VMware", "vmware"},
+	{"VirtualBox", "oracle"},
+	{"Xen", "xen"},
+	{"Amazon EC2", "amazon"},
+	{"Google Compute Engine", "google"},
+	{"Virtual Machine", "microsoft"},
+	{"Parallels", "parallels"},
+}
+
+// parseVirt parses 'virt kvm' from systemd-detect-virt, and the DMI vendor and product like
+// /sys/class/dmi/id/sys_vendor:QEMU
+func (f *InventorySystemStat) parseVirt(out string) {
+
+	f.Virtualization = ""
+	f.Vendor = ""
+	f.Product = ""
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+
+		if virt, ok := strings.CutPrefix(line, "virt"); ok {
+			f.Virtualization = strings.TrimSpace(virt)
+			continue
+		}
+
+		file, value, ok := strings.Cut(line, ":")
+
+		if !ok {
+			continue
+		}
+
+		switch {
+		case strings.HasSuffix(file, "/sys_vendor"):
+			f.Vendor = strings.TrimSpace(value)
+		case strings.HasSuffix(file, "/product_name"):
+			f.Product = strings.TrimSpace(value)
+		}
+	}
+
+	if f.Virtualization != "" {
+		return
+	}
+
+	for _, d := range dmiVirt {
+
+		if strings.Contains(f.Vendor, d.match) || strings.Contains(f.Product, d.match) {
+			f.Virtualization = d.virt
+			return
+		}
+	}
+
+	// without systemd-detect-virt bare metal cannot be told apart from an unknown hypervisor
+}
@@ -9,15 +9,77 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// NetIntfCounters are the 16 columns of /proc/net/dev in order
+type NetIntfCounters struct {
+	RxBytes      uint64 `json:"rx_bytes"`
+	RxPackets    uint64 `json:"rx_packets"`
+	RxErrs       uint64 `json:"rx_errs"`
+	RxDrop       uint64 `json:"rx_drop"`
+	RxFifo       uint64 `json:"rx_fifo"`
+	RxFrame      uint64 `json:"rx_frame"`
+	RxCompressed uint64 `json:"rx_compressed"`
+	RxMulticast  uint64 `json:"rx_multicast"`
+	TxBytes      uint64 `json:"tx_bytes"`
+	TxPackets    uint64 `json:"tx_packets"`
+	TxErrs       uint64 `json:"tx_errs"`
+	TxDrop       uint64 `json:"tx_drop"`
+	TxFifo       uint64 `json:"tx_fifo"`
+	TxColls      uint64 `json:"tx_colls"`
+	TxCarrier    uint64 `json:"tx_carrier"`
+	TxCompressed uint64 `json:"tx_compressed"`
+}
+
+type NetAddr struct {
+	Family    string   `json:"family"` // inet or inet6
+	Address   string   `json:"address"`
+	PrefixLen int      `json:"prefix_len"`
+	Scope     string   `json:"scope"`           // global, link, host...
+	Flags     []string `json:"flags"`           // dynamic, deprecated, secondary...
+	Label     string   `json:"label,omitempty"` // the label of an IPv4 alias like eth0:1
+}
+
+// String is the address with its prefix like 10.0.0.1/24
+func (a NetAddr) String() string {
+	return a.Address + "/" + strconv.Itoa(a.PrefixLen)
+}
+
 type NetIntfInfo struct {
-	IPv4 string
-	IPv6 string
-	Rx   uint64
-	Tx   uint64
+
+	// IPv4 and IPv6 are the primary address of each family, every address is in Addrs
+	IPv4  string    `json:"ipv4"`
+	IPv6  string    `json:"ipv6"`
+	Addrs []NetAddr `json:"addrs"`
+
+	MTU       int    `json:"mtu"`
+	MAC       string `json:"mac"`
+	OperState string `json:"oper_state"`
+	Speed     int    `json:"speed_mbps"` // Mb/s, 0 when the driver does not report it
+	Rx        uint64 `json:"rx"`
+	Tx        uint64 `json:"tx"`
+
+	Counters NetIntfCounters `json:"counters"`
+
+	// Delta is how much every counter went up since the last poll, it is zero on the first poll
+	Delta NetIntfCounters `json:"delta"`
+
+	RxBytesPerSec   uint64  `json:"rx_bytes_per_sec"`
+	TxBytesPerSec   uint64  `json:"tx_bytes_per_sec"`
+	RxPacketsPerSec float32 `json:"rx_packets_per_sec"`
+	TxPacketsPerSec float32 `json:"tx_packets_per_sec"`
 }
 
 type NetIntfSystemStat struct {
-	NetIntf map[string]NetIntfInfo
+	NetIntf map[string]NetIntfInfo `json:"interfaces"`
+
+	// Elapsed is the seconds since the last poll, the rates and deltas are only set when it is not 0
+	Elapsed float64 `json:"elapsed_seconds"`
+
+	prevCounters map[string]NetIntfCounters
+	prevUptime   float64
+}
+
+func (f *NetIntfSystemStat) Name() string {
+	return "network"
 }
 
 func (f *NetIntfSystemStat) CmdCount(sh shell.ShellType) int {
@@ -27,7 +89,7 @@ func (f *NetIntfSystemStat) CmdCount(sh shell.ShellType) int {
 		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
 
 	case shell.PosixShellType:
-		return 2
+		return 5
 	}
 	return 0
 }
@@ -47,6 +109,16 @@ func (f *NetIntfSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
 
 		cmds[1].Cmd = "cat /proc/net/dev"
 		cmds[1].Stdin = nil
+
+		cmds[2].Cmd = "cat /proc/uptime"
+		cmds[2].Stdin = nil
+
+		cmds[3].Cmd = "ip -o link"
+		cmds[3].Stdin = nil
+
+		// virtual interfaces fail to read their speed, which is fine
+		cmds[4].Cmd = "grep -H . /sys/class/net/*/speed 2>/dev/null"
+		cmds[4].Stdin = nil
 	}
 
 	return cmds
@@ -68,36 +140,35 @@ func (f *NetIntfSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
 		}
 	}
 
+	// every interface is in 'ip -o link', also the ones without an address like bond slaves or links which are down
+	if len(outs) >= 5 {
+		f.parseLinks(outs[3], outs[4])
+	}
+
 	{
 		scanner := bufio.NewScanner(strings.NewReader(outs[0]))
 
 		for scanner.Scan() {
 
-			line := scanner.Text()
-			parts := strings.Fields(line)
-
-			if len(parts) >= 4 && (parts[2] == "inet" || parts[2] == "inet6") {
-
-				ipv4 := parts[2] == "inet"
-				intfname := parts[1]
-
-				if info, ok := f.NetIntf[intfname]; ok {
-					if ipv4 {
-						info.IPv4 = parts[3]
-					} else {
-						info.IPv6 = parts[3]
-					}
-					f.NetIntf[intfname] = info
-				} else {
-					info := NetIntfInfo{}
-					if ipv4 {
-						info.IPv4 = parts[3]
-					} else {
-						info.IPv6 = parts[3]
-					}
-					f.NetIntf[intfname] = info
-				}
+			intfname, addr, ok := parseIPAddrLine(scanner.Text())
+
+			if !ok {
+				continue
+			}
+
+			info := f.NetIntf[intfname]
+			info.Addrs = append(info.Addrs, addr)
+
+			if addr.Family == "inet" && info.IPv4 == "" {
+				info.IPv4 = addr.String()
+			}
+
+			// a link local address is only the primary one until a global one is found
+			if addr.Family == "inet6" && (info.IPv6 == "" || (strings.HasPrefix(info.IPv6, "fe80:") && addr.Scope == "global")) {
+				info.IPv6 = addr.String()
 			}
+
+			f.NetIntf[intfname] = info
 		}
 	}
 
@@ -106,38 +177,232 @@ func (f *NetIntfSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
 		return
 	}
 
+	uptime := -1.0
+
+	if len(outs) >= 3 {
+		if parts := strings.Fields(outs[2]); len(parts) > 0 {
+			if v, err := strconv.ParseFloat(parts[0], 64); err == nil {
+				uptime = v
+			}
+		}
+	}
+
+	f.Elapsed = 0
+
+	if uptime > 0 && f.prevCounters != nil && uptime > f.prevUptime {
+		f.Elapsed = uptime - f.prevUptime
+	}
+
+	counters := make(map[string]NetIntfCounters)
+
 	{
 		scanner := bufio.NewScanner(strings.NewReader(outs[1]))
 
 		for scanner.Scan() {
 
 			line := scanner.Text()
-			parts := strings.Fields(line)
 
-			if len(parts) != 17 {
+			// the name and the first column can be joined like 'eth0:1234' when the counter is large
+			name, rest, ok := strings.Cut(line, ":")
+
+			if !ok {
 				continue
 			}
-			intf := strings.TrimSpace(parts[0])
-			intf = strings.TrimSuffix(intf, ":")
 
-			if info, ok := f.NetIntf[intf]; ok {
+			parts := strings.Fields(rest)
+
+			if len(parts) != 16 {
+				continue
+			}
+
+			intf := strings.TrimSpace(name)
+
+			var values [16]uint64
+			valid := true
 
-				rx, err := strconv.ParseUint(parts[1], 10, 64)
+			for i, part := range parts {
+
+				v, err := strconv.ParseUint(part, 10, 64)
 
 				if err != nil {
-					continue
+					valid = false
+					break
 				}
+				values[i] = v
+			}
+
+			if !valid {
+				continue
+			}
 
-				tx, err := strconv.ParseUint(parts[9], 10, 64)
+			c := NetIntfCounters{
+				RxBytes: values[0], RxPackets: values[1], RxErrs: values[2], RxDrop: values[3],
+				RxFifo: values[4], RxFrame: values[5], RxCompressed: values[6], RxMulticast: values[7],
+				TxBytes: values[8], TxPackets: values[9], TxErrs: values[10], TxDrop: values[11],
+				TxFifo: values[12], TxColls: values[13], TxCarrier: values[14], TxCompressed: values[15],
+			}
 
-				if err != nil {
-					continue
+			counters[intf] = c
+
+			if info, ok := f.NetIntf[intf]; ok {
+
+				info.Rx = c.RxBytes
+				info.Tx = c.TxBytes
+				info.Counters = c
+
+				if pre, ok := f.prevCounters[intf]; ok && f.Elapsed > 0 {
+
+					info.Delta = c.sub(pre)
+					info.RxBytesPerSec = uint64(float64(info.Delta.RxBytes) / f.Elapsed)
+					info.TxBytesPerSec = uint64(float64(info.Delta.TxBytes) / f.Elapsed)
+					info.RxPacketsPerSec = float32(float64(info.Delta.RxPackets) / f.Elapsed)
+					info.TxPacketsPerSec = float32(float64(info.Delta.TxPackets) / f.Elapsed)
 				}
-				info.Rx = rx
-				info.Tx = tx
+
 				f.NetIntf[intf] = info
 			}
 		}
 	}
 
+	if uptime > 0 {
+		f.prevCounters = counters
+		f.prevUptime = uptime
+	}
+}
+
+// sub returns how much every counter went up since pre
+func (c NetIntfCounters) sub(pre NetIntfCounters) NetIntfCounters {
+	return NetIntfCounters{
+		RxBytes:      counterDelta(pre.RxBytes, c.RxBytes),
+		RxPackets:    counterDelta(pre.RxPackets, c.RxPackets),
+		RxErrs:       counterDelta(pre.RxErrs, c.RxErrs),
+		RxDrop:       counterDelta(pre.RxDrop, c.RxDrop),
+		RxFifo:       counterDelta(pre.RxFifo, c.RxFifo),
+		RxFrame:      counterDelta(pre.RxFrame, c.RxFrame),
+		RxCompressed: counterDelta(pre.RxCompressed, c.RxCompressed),
+		RxMulticast:  counterDelta(pre.RxMulticast, c.RxMulticast),
+		TxBytes:      counterDelta(pre.TxBytes, c.TxBytes),
+		TxPackets:    counterDelta(pre.TxPackets, c.TxPackets),
+		TxErrs:       counterDelta(pre.TxErrs, c.TxErrs),
+		TxDrop:       counterDelta(pre.TxDrop, c.TxDrop),
+		TxFifo:       counterDelta(pre.TxFifo, c.TxFifo),
+		TxColls:      counterDelta(pre.TxColls, c.TxColls),
+		TxCarrier:    counterDelta(pre.TxCarrier, c.TxCarrier),
+		TxCompressed: counterDelta(pre.TxCompressed, c.TxCompressed),
+	}
+}
+
+// parseIPAddrLine parses a line of 'ip -o addr' like
+// '2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global secondary dynamic eth0:1\       valid_lft 3600sec preferred_lft 3600sec'
+func parseIPAddrLine(line string) (string, NetAddr, bool) {
+
+	// everything after the backslash is the lifetimes
+	line, _, _ = strings.Cut(line, "\\")
+
+	parts := strings.Fields(line)
+
+	if len(parts) < 4 || (parts[2] != "inet" && parts[2] != "inet6") {
+		return "", NetAddr{}, false
+	}
+
+	intfname, _, _ := strings.Cut(parts[1], "@")
+	addr := NetAddr{Family: parts[2], Flags: []string{}}
+
+	address, prefix, ok := strings.Cut(parts[3], "/")
+	addr.Address = address
+
+	if ok {
+		addr.PrefixLen, _ = strconv.Atoi(prefix)
+	} else if addr.Family == "inet" {
+		addr.PrefixLen = 32
+	} else {
+		addr.PrefixLen = 128
+	}
+
+	for i := 4; i < len(parts); i++ {
+
+		switch parts[i] {
+
+		case "brd", "peer", "metric", "proto":
+			// these are followed by a value we do not keep
+			i++
+
+		case "scope":
+			if i+1 < len(parts) {
+				addr.Scope = parts[i+1]
+				i++
+			}
+
+		default:
+			if parts[i] == intfname || strings.HasPrefix(parts[i], intfname+":") {
+				addr.Label = parts[i]
+			} else {
+				addr.Flags = append(addr.Flags, parts[i])
+			}
+		}
+	}
+
+	return intfname, addr, true
+}
+
+// parseLinks adds the interfaces of 'ip -o link' with their MTU, MAC and state, and the speed from /sys/class/net/*/speed
+func (f *NetIntfSystemStat) parseLinks(links string, speeds string) {
+
+	scanner := bufio.NewScanner(strings.NewReader(links))
+
+	for scanner.Scan() {
+
+		// 2: eth0@if5: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP mode DEFAULT group default qlen 1000\    link/ether 02:42:ac:11:00:02 brd ff:ff:ff:ff:ff:ff link-netnsid 0
+		parts := strings.Fields(strings.ReplaceAll(scanner.Text(), "\\", " "))
+
+		if len(parts) < 3 {
+			continue
+		}
+
+		intfname := strings.TrimSuffix(parts[1], ":")
+		intfname, _, _ = strings.Cut(intfname, "@")
+
+		info := f.NetIntf[intfname]
+
+		if info.Addrs == nil {
+			info.Addrs = make([]NetAddr, 0)
+		}
+
+		for i := 2; i+1 < len(parts); i++ {
+
+			switch {
+			case parts[i] == "mtu":
+				info.MTU, _ = strconv.Atoi(parts[i+1])
+			case parts[i] == "state":
+				info.OperState = parts[i+1]
+			case strings.HasPrefix(parts[i], "link/") && parts[i] != "link/none":
+				info.MAC = parts[i+1]
+			}
+		}
+
+		f.NetIntf[intfname] = info
+	}
+
+	scanner = bufio.NewScanner(strings.NewReader(speeds))
+
+	for scanner.Scan() {
+
+		// /sys/class/net/eth0/speed:1000
+		path, value, ok := strings.Cut(scanner.Text(), ":")
+
+		if !ok {
+			continue
+		}
+
+		intfname := strings.TrimSuffix(strings.TrimPrefix(path, "/sys/class/net/"), "/speed")
+
+		// a link which is down reports -1
+		if speed, err := strconv.Atoi(value); err == nil && speed > 0 {
+
+			if info, ok := f.NetIntf[intfname]; ok {
+				info.Speed = speed
+				f.NetIntf[intfname] = info
+			}
+		}
+	}
 }
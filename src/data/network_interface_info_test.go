@@ -0,0 +1,99 @@
+package data
+
+import (
+	"mitosu/src/shell"
+	"testing"
+)
+
+const ipAddr = `1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+1: lo    inet6 ::1/128 scope host noprefixroute \       valid_lft forever preferred_lft forever
+2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global dynamic eth0\       valid_lft 3600sec preferred_lft 3600sec
+2: eth0    inet 10.0.0.6/24 brd 10.0.0.255 scope global secondary eth0:1\       valid_lft forever preferred_lft forever
+2: eth0    inet6 fe80::1/64 scope link \       valid_lft forever preferred_lft forever
+2: eth0    inet6 2001:db8::5/64 scope global dynamic mngtmpaddr \       valid_lft 86400sec preferred_lft 14400sec
+`
+
+// eth1 is a bond slave and eth2 is down, neither has an address
+const ipLink = `1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN mode DEFAULT group default qlen 1000\    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00
+2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc fq_codel state UP mode DEFAULT group default qlen 1000\    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff
+3: eth1: <BROADCAST,MULTICAST,SLAVE,UP,LOWER_UP> mtu 9000 qdisc fq_codel master bond0 state UP mode DEFAULT group default qlen 1000\    link/ether 52:54:00:ab:cd:ef brd ff:ff:ff:ff:ff:ff
+4: eth2: <BROADCAST,MULTICAST> mtu 1500 qdisc noop state DOWN mode DEFAULT group default qlen 1000\    link/ether 52:54:00:00:00:02 brd ff:ff:ff:ff:ff:ff
+5: wg0: <POINTOPOINT,NOARP,UP,LOWER_UP> mtu 1420 qdisc noqueue state UNKNOWN mode DEFAULT group default qlen 1000\    link/none 
+`
+
+const netSpeeds = `/sys/class/net/eth0/speed:1000
+/sys/class/net/eth1/speed:10000
+/sys/class/net/eth2/speed:-1
+`
+
+const netDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0:12345678   10000    1    2    0     0          0         5  2345678    8000    0    0    0     0       0          0
+  eth1:  500000     400    0    0    0     0          0         0   600000     500    0    0    0     0       0          0
+  eth2:       0       0    0    0    0     0          0         0        0       0    0    0    0     0       0          0
+   wg0:     100       1    0    0    0     0          0         0      200       2    0    0    0     0       0          0
+`
+
+const netDevLater = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0:12355678   10100    1    2    0     0          0         5  2365678    8200    0    0    0     0       0          0
+  eth1:  500000     400    0    0    0     0          0         0   600000     500    0    0    0     0       0          0
+  eth2:       0       0    0    0    0     0          0         0        0       0    0    0    0     0       0          0
+   wg0:     100       1    0    0    0     0          0         0      200       2    0    0    0     0       0          0
+`
+
+func TestNetIntf(t *testing.T) {
+
+	f := &NetIntfSystemStat{}
+	f.ParseCmdOutput(shell.PosixShellType, []string{ipAddr, netDev, "100.00 400.00", ipLink, netSpeeds})
+
+	if len(f.NetIntf) != 5 {
+		t.Fatalf("got %d interfaces, want every link %v", len(f.NetIntf), f.NetIntf)
+	}
+
+	eth0 := f.NetIntf["eth0"]
+
+	if eth0.IPv4 != "10.0.0.5/24" || eth0.IPv6 != "2001:db8::5/64" || len(eth0.Addrs) != 4 {
+		t.Errorf("eth0 addresses %q %q %+v", eth0.IPv4, eth0.IPv6, eth0.Addrs)
+	}
+
+	if a := eth0.Addrs[1]; a.Label != "eth0:1" || len(a.Flags) != 1 || a.Flags[0] != "secondary" {
+		t.Errorf("the alias of eth0 %+v", a)
+	}
+
+	if eth0.MTU != 1500 || eth0.MAC != "52:54:00:12:34:56" || eth0.OperState != "UP" || eth0.Speed != 1000 {
+		t.Errorf("eth0 link %+v", eth0)
+	}
+
+	if eth0.Counters.RxBytes != 12345678 || eth0.Counters.RxMulticast != 5 || eth0.Rx != 12345678 || eth0.Tx != 2345678 {
+		t.Errorf("eth0 counters %+v", eth0.Counters)
+	}
+
+	if eth0.RxBytesPerSec != 0 || f.Elapsed != 0 {
+		t.Errorf("the first poll has no rates, got %d over %v", eth0.RxBytesPerSec, f.Elapsed)
+	}
+
+	eth1 := f.NetIntf["eth1"]
+
+	if eth1.Addrs == nil || len(eth1.Addrs) != 0 || eth1.MTU != 9000 || eth1.Speed != 10000 || eth1.Rx != 500000 {
+		t.Errorf("the bond slave eth1 without an address %+v", eth1)
+	}
+
+	if eth2 := f.NetIntf["eth2"]; eth2.OperState != "DOWN" || eth2.Speed != 0 || eth2.MAC != "52:54:00:00:00:02" {
+		t.Errorf("the down link eth2 %+v", eth2)
+	}
+
+	if wg0 := f.NetIntf["wg0"]; wg0.MAC != "" || wg0.MTU != 1420 {
+		t.Errorf("wg0 has no MAC %+v", wg0)
+	}
+
+	f.ParseCmdOutput(shell.PosixShellType, []string{ipAddr, netDevLater, "110.00 440.00", ipLink, netSpeeds})
+
+	eth0 = f.NetIntf["eth0"]
+
+	if f.Elapsed != 10 || eth0.RxBytesPerSec != 1000 || eth0.TxBytesPerSec != 2000 || eth0.RxPacketsPerSec != 10 || eth0.Delta.TxPackets != 200 {
+		t.Errorf("eth0 rates over %v seconds %+v", f.Elapsed, eth0)
+	}
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PressureAvgs are the percent of time tasks were stalled over the last 10, 60 and 300 seconds
+type PressureAvgs struct {
+	Avg10  float32 `json:"avg10"`
+	Avg60  float32 `json:"avg60"`
+	Avg300 float32 `json:"avg300"`
+	Total  uint64  `json:"total_us"` // total stall time in microseconds
+}
+
+// Pressure is one file from /proc/pressure, Some is when at least one task was stalled and Full when all were
+type Pressure struct {
+	Some PressureAvgs `json:"some"`
+	Full PressureAvgs `json:"full"`
+}
+
+// PressureInfo has the pressure of each resource, each is nil when the kernel does not have it
+type PressureInfo struct {
+	CPU    *Pressure `json:"cpu"`
+	Memory *Pressure `json:"memory"`
+	IO     *Pressure `json:"io"`
+}
+
+// parse parses the output of grep -H . on the /proc/pressure files, lines like
+// /proc/pressure/io:some avg10=0.00 avg60=0.12 avg300=0.05 total=123456
+func (p *PressureInfo) parse(lines string) error {
+
+	*p = PressureInfo{}
+
+	scanner := bufio.NewScanner(strings.NewReader(lines))
+
+	for scanner.Scan() {
+
+		path, line, ok := strings.Cut(scanner.Text(), ":")
+
+		if !ok {
+			continue
+		}
+
+		var pressure **Pressure
+
+		switch strings.TrimPrefix(path, "/proc/pressure/") {
+		case "cpu":
+			pressure = &p.CPU
+		case "memory":
+			pressure = &p.Memory
+		case "io":
+			pressure = &p.IO
+		default:
+			continue
+		}
+
+		if *pressure == nil {
+			*pressure = &Pressure{}
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) < 1 {
+			continue
+		}
+
+		var avgs *PressureAvgs
+
+		switch fields[0] {
+		case "some":
+			avgs = &(*pressure).Some
+		case "full":
+			avgs = &(*pressure).Full
+		default:
+			return fmt.Errorf("unknown pressure line: %s", line)
+		}
+
+		for _, field := range fields[1:] {
+
+			key, val, _ := strings.Cut(field, "=")
+
+			switch key {
+			case "avg10", "avg60", "avg300":
+
+				n, err := strconv.ParseFloat(val, 32)
+
+				if err != nil {
+					return err
+				}
+
+				switch key {
+				case "avg10":
+					avgs.Avg10 = float32(n)
+				case "avg60":
+					avgs.Avg60 = float32(n)
+				case "avg300":
+					avgs.Avg300 = float32(n)
+				}
+
+			case "total":
+
+				n, err := strconv.ParseUint(val, 10, 64)
+
+				if err != nil {
+					return err
+				}
+
+				avgs.Total = n
+			}
+		}
+	}
+
+	return nil
+}
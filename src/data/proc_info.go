@@ -11,50 +11,88 @@ import (
 )
 
 type CPURaw struct {
-	User    uint64 // time spent in user mode
-	Nice    uint64 // time spent in user mode with low priority (nice)
-	System  uint64 // time spent in system mode
-	Idle    uint64 // time spent in the idle task
-	Iowait  uint64 // time spent waiting for I/O to complete (since Linux 2.5.41)
-	Irq     uint64 // time spent servicing  interrupts  (since  2.6.0-test4)
-	SoftIrq uint64 // time spent servicing softirqs (since 2.6.0-test4)
-	Steal   uint64 // time spent in other OSes when running in a virtualized environment
-	Guest   uint64 // time spent running a virtual CPU for guest operating systems under the control of the Linux kernel.
-	Total   uint64 // total of all time fields
+	User    uint64 `json:"user"`    // time spent in user mode
+	Nice    uint64 `json:"nice"`    // time spent in user mode with low priority (nice)
+	System  uint64 `json:"system"`  // time spent in system mode
+	Idle    uint64 `json:"idle"`    // time spent in the idle task
+	Iowait  uint64 `json:"iowait"`  // time spent waiting for I/O to complete (since Linux 2.5.41)
+	Irq     uint64 `json:"irq"`     // time spent servicing  interrupts  (since  2.6.0-test4)
+	SoftIrq uint64 `json:"softirq"` // time spent servicing softirqs (since 2.6.0-test4)
+	Steal   uint64 `json:"steal"`   // time spent in other OSes when running in a virtualized environment
+	Guest   uint64 `json:"guest"`   // time spent running a virtual CPU for guest operating systems under the control of the Linux kernel.
+	Total   uint64 `json:"total"`   // total of all time fields
 }
 
 type CPUInfo struct {
-	Total   uint64 // total of all time fields
-	User    float32
-	Nice    float32
-	System  float32
-	Idle    float32
-	Iowait  float32
-	Irq     float32
-	SoftIrq float32
-	Steal   float32
-	Guest   float32
+	Total   uint64  `json:"total"` // total of all time fields
+	User    float32 `json:"user"`
+	Nice    float32 `json:"nice"`
+	System  float32 `json:"system"`
+	Idle    float32 `json:"idle"`
+	Iowait  float32 `json:"iowait"`
+	Irq     float32 `json:"irq"`
+	SoftIrq float32 `json:"softirq"`
+	Steal   float32 `json:"steal"`
+	Guest   float32 `json:"guest"`
 }
 
 type ProcInfoSystemStat struct {
-	Hostname string
-
-	Uptime time.Duration
-
-	CPU    CPUInfo
-	CPURaw CPURaw
-
-	Load1        string
-	Load5        string
-	Load10       string
-	RunningProcs string
-	TotalProcs   string
-	MemTotal     uint64
-	MemFree      uint64
-	MemBuffers   uint64
-	MemCached    uint64
-	SwapTotal    uint64
-	SwapFree     uint64
+	Hostname string `json:"hostname"`
+
+	Uptime        time.Duration `json:"-"`
+	UptimeSeconds float64       `json:"uptime_seconds"`
+
+	CPU    CPUInfo `json:"cpu"`
+	CPURaw CPURaw  `json:"cpu_raw"`
+
+	// Cores and CoresRaw are the same as CPU and CPURaw for each core, indexed by the N in cpuN.
+	// A core is nil when it is offline, and in Cores also when it has no previous sample yet.
+	Cores    []*CPUInfo `json:"cores"`
+	CoresRaw []*CPURaw  `json:"cores_raw"`
+
+	Load1        float64 `json:"load1"`
+	Load5        float64 `json:"load5"`
+	Load15       float64 `json:"load15"`
+	RunningProcs int     `json:"running_procs"`
+	TotalProcs   int     `json:"total_procs"`
+	MemTotal     uint64  `json:"mem_total"`
+	MemFree      uint64  `json:"mem_free"`
+	MemBuffers   uint64  `json:"mem_buffers"`
+	MemCached    uint64  `json:"mem_cached"`
+	SwapTotal    uint64  `json:"swap_total"`
+	SwapFree     uint64  `json:"swap_free"`
+
+	// MemAvailable is the kernel's estimate of the memory which can be used without swapping,
+	// before Linux 3.14 it is estimated as free + buffers + cached
+	MemAvailable uint64  `json:"mem_available"`
+	MemUsed      uint64  `json:"mem_used"` // total - available
+	MemUsedPerc  float32 `json:"mem_used_percent"`
+	SwapUsed     uint64  `json:"swap_used"`
+	SwapUsedPerc float32 `json:"swap_used_percent"`
+
+	MemShmem        uint64 `json:"mem_shmem"`
+	MemSlab         uint64 `json:"mem_slab"`
+	MemSReclaimable uint64 `json:"mem_sreclaimable"`
+	MemDirty        uint64 `json:"mem_dirty"`
+	MemWriteback    uint64 `json:"mem_writeback"`
+
+	// CommittedAS is the memory allocated by processes, it is over CommitLimit when overcommitted
+	CommitLimit uint64 `json:"commit_limit"`
+	CommittedAS uint64 `json:"committed_as"`
+
+	// HugePages are counts of pages of HugePageSize bytes
+	HugePagesTotal uint64 `json:"hugepages_total"`
+	HugePagesFree  uint64 `json:"hugepages_free"`
+	HugePagesRsvd  uint64 `json:"hugepages_rsvd"`
+	HugePagesSurp  uint64 `json:"hugepages_surp"`
+	HugePageSize   uint64 `json:"hugepage_size"`
+
+	// Pressure is the pressure stall information, which needs Linux 4.20 built with PSI
+	Pressure PressureInfo `json:"pressure"`
+}
+
+func (f *ProcInfoSystemStat) Name() string {
+	return "system"
 }
 
 func (f *ProcInfoSystemStat) CmdCount(sh shell.ShellType) int {
@@ -62,7 +100,7 @@ func (f *ProcInfoSystemStat) CmdCount(sh shell.ShellType) int {
 	default:
 		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
 	case shell.PosixShellType:
-		return 5
+		return 6
 	}
 	return 0
 }
@@ -82,6 +120,7 @@ func (f *ProcInfoSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
 		cmds[2].Cmd = "cat /proc/loadavg"
 		cmds[3].Cmd = "cat /proc/meminfo"
 		cmds[4].Cmd = "cat /proc/stat"
+		cmds[5].Cmd = "grep -H . /proc/pressure/cpu /proc/pressure/memory /proc/pressure/io 2>/dev/null"
 
 	}
 
@@ -101,7 +140,7 @@ func (f *ProcInfoSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
 	log.Debug().Err(err).Msg("Parsing hostname")
 
 	if len(outs) < 2 {
-		log.Debug().Msg("Could only parse 1 of 5 proc stats")
+		log.Debug().Msg("Could only parse 1 of 6 proc stats")
 		return
 	}
 
@@ -109,7 +148,7 @@ func (f *ProcInfoSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
 	log.Debug().Err(err).Msg("Parsing uptime")
 
 	if len(outs) < 3 {
-		log.Debug().Msg("Could only parse 2 of 5 proc stats")
+		log.Debug().Msg("Could only parse 2 of 6 proc stats")
 		return
 	}
 
@@ -117,20 +156,28 @@ func (f *ProcInfoSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
 	log.Debug().Err(err).Msg("Parsing load")
 
 	if len(outs) < 4 {
-		log.Debug().Msg("Could only parse 3 of 5 proc stats")
+		log.Debug().Msg("Could only parse 3 of 6 proc stats")
 		return
 	}
 
 	err = f.getMemInfo(outs[3])
 	log.Debug().Err(err).Msg("Parsing memory info")
 
-	if len(outs) < 4 {
-		log.Debug().Msg("Could only parse 4 of 5 proc stats")
+	if len(outs) < 5 {
+		log.Debug().Msg("Could only parse 4 of 6 proc stats")
 		return
 	}
 
 	err = f.getCPU(outs[4])
 	log.Debug().Err(err).Msg("Parsing CPU")
+
+	if len(outs) < 6 {
+		log.Debug().Msg("Could only parse 5 of 6 proc stats")
+		return
+	}
+
+	err = f.Pressure.parse(outs[5])
+	log.Debug().Err(err).Msg("Parsing pressure")
 }
 
 func (f *ProcInfoSystemStat) getHostname(hostname string) error {
@@ -153,6 +200,7 @@ func (f *ProcInfoSystemStat) getUptime(uptime string) error {
 			return err
 		}
 		f.Uptime = time.Duration(upsecs * 1e9)
+		f.UptimeSeconds = upsecs
 	}
 
 	return nil
@@ -163,13 +211,13 @@ func (f *ProcInfoSystemStat) getLoad(line string) error {
 	parts := strings.Fields(line)
 
 	if len(parts) == 5 {
-		f.Load1 = parts[0]
-		f.Load5 = parts[1]
-		f.Load10 = parts[2]
+		f.Load1, _ = strconv.ParseFloat(parts[0], 64)
+		f.Load5, _ = strconv.ParseFloat(parts[1], 64)
+		f.Load15, _ = strconv.ParseFloat(parts[2], 64)
 		if i := strings.Index(parts[3], "/"); i != -1 {
-			f.RunningProcs = parts[3][0:i]
+			f.RunningProcs, _ = strconv.Atoi(parts[3][0:i])
 			if i+1 < len(parts[3]) {
-				f.TotalProcs = parts[3][i+1:]
+				f.TotalProcs, _ = strconv.Atoi(parts[3][i+1:])
 			}
 		}
 	}
@@ -180,6 +228,7 @@ func (f *ProcInfoSystemStat) getLoad(line string) error {
 func (f *ProcInfoSystemStat) getMemInfo(lines string) error {
 
 	scanner := bufio.NewScanner(strings.NewReader(lines))
+	hasAvailable := false
 
 	for scanner.Scan() {
 
@@ -187,7 +236,8 @@ func (f *ProcInfoSystemStat) getMemInfo(lines string) error {
 
 		parts := strings.Fields(line)
 
-		if len(parts) != 3 {
+		// the HugePages_ counts have no kB
+		if len(parts) != 3 && len(parts) != 2 {
 			continue
 		}
 
@@ -197,13 +247,18 @@ func (f *ProcInfoSystemStat) getMemInfo(lines string) error {
 			continue
 		}
 
-		val *= 1024
+		if len(parts) == 3 {
+			val *= 1024
+		}
 
 		switch parts[0] {
 		case "MemTotal:":
 			f.MemTotal = val
 		case "MemFree:":
 			f.MemFree = val
+		case "MemAvailable:":
+			f.MemAvailable = val
+			hasAvailable = true
 		case "Buffers:":
 			f.MemBuffers = val
 		case "Cached:":
@@ -212,18 +267,56 @@ func (f *ProcInfoSystemStat) getMemInfo(lines string) error {
 			f.SwapTotal = val
 		case "SwapFree:":
 			f.SwapFree = val
+		case "Shmem:":
+			f.MemShmem = val
+		case "Slab:":
+			f.MemSlab = val
+		case "SReclaimable:":
+			f.MemSReclaimable = val
+		case "Dirty:":
+			f.MemDirty = val
+		case "Writeback:":
+			f.MemWriteback = val
+		case "CommitLimit:":
+			f.CommitLimit = val
+		case "Committed_AS:":
+			f.CommittedAS = val
+		case "HugePages_Total:":
+			f.HugePagesTotal = val
+		case "HugePages_Free:":
+			f.HugePagesFree = val
+		case "HugePages_Rsvd:":
+			f.HugePagesRsvd = val
+		case "HugePages_Surp:":
+			f.HugePagesSurp = val
+		case "Hugepagesize:":
+			f.HugePageSize = val
 		}
 	}
 
+	if !hasAvailable {
+		f.MemAvailable = f.MemFree + f.MemBuffers + f.MemCached
+	}
+
+	f.MemUsed = f.MemTotal - min(f.MemAvailable, f.MemTotal)
+	f.SwapUsed = f.SwapTotal - min(f.SwapFree, f.SwapTotal)
+
+	if f.MemTotal > 0 {
+		f.MemUsedPerc = float32(float64(f.MemUsed) / float64(f.MemTotal) * 100)
+	}
+
+	if f.SwapTotal > 0 {
+		f.SwapUsedPerc = float32(float64(f.SwapUsed) / float64(f.SwapTotal) * 100)
+	}
+
 	return nil
 }
 
 func (f *ProcInfoSystemStat) getCPU(lines string) error {
 
-	var (
-		nowCPU CPURaw
-		total  float32
-	)
+	var nowCPU CPURaw
+
+	nowCores := make([]*CPURaw, 0, len(f.CoresRaw))
 
 	scanner := bufio.NewScanner(strings.NewReader(lines))
 
@@ -232,62 +325,125 @@ func (f *ProcInfoSystemStat) getCPU(lines string) error {
 		line := scanner.Text()
 
 		fields := strings.Fields(line)
-		numFields := len(fields)
 
-		if numFields <= 0 || fields[0] != "cpu" { // changing here if want to get every cpu-core's stats
+		if len(fields) <= 0 || !strings.HasPrefix(fields[0], "cpu") {
 			continue
 		}
 
-		for i := 1; i < numFields; i++ {
+		raw := parseCPURaw(fields)
 
-			val, err := strconv.ParseUint(fields[i], 10, 64)
+		if fields[0] == "cpu" {
+			nowCPU = raw
+			continue
+		}
 
-			if err != nil {
-				continue
-			}
+		core, err := strconv.Atoi(fields[0][len("cpu"):])
 
-			nowCPU.Total += val
-			switch i {
-			case 1:
-				nowCPU.User = val
-			case 2:
-				nowCPU.Nice = val
-			case 3:
-				nowCPU.System = val
-			case 4:
-				nowCPU.Idle = val
-			case 5:
-				nowCPU.Iowait = val
-			case 6:
-				nowCPU.Irq = val
-			case 7:
-				nowCPU.SoftIrq = val
-			case 8:
-				nowCPU.Steal = val
-			case 9:
-				nowCPU.Guest = val
-			}
+		if err != nil || core < 0 {
+			continue
 		}
 
-		break
+		// offline cores are missing from /proc/stat, so keep the index matching the core number
+		for len(nowCores) <= core {
+			nowCores = append(nowCores, nil)
+		}
+
+		nowCores[core] = &raw
 	}
 
-	preCPU := f.CPURaw
-
-	if preCPU.Total != 0 { // having no pre raw cpu data
-		total = float32(nowCPU.Total - preCPU.Total)
-		f.CPU.User = float32(nowCPU.User-preCPU.User) / total * 100
-		f.CPU.Nice = float32(nowCPU.Nice-preCPU.Nice) / total * 100
-		f.CPU.System = float32(nowCPU.System-preCPU.System) / total * 100
-		f.CPU.Idle = float32(nowCPU.Idle-preCPU.Idle) / total * 100
-		f.CPU.Iowait = float32(nowCPU.Iowait-preCPU.Iowait) / total * 100
-		f.CPU.Irq = float32(nowCPU.Irq-preCPU.Irq) / total * 100
-		f.CPU.SoftIrq = float32(nowCPU.SoftIrq-preCPU.SoftIrq) / total * 100
-		f.CPU.Guest = float32(nowCPU.Guest-preCPU.Guest) / total * 100
-		f.CPU.Total = nowCPU.Total
+	if f.CPURaw.Total != 0 { // having no pre raw cpu data
+		f.CPU = cpuUsage(f.CPURaw, nowCPU)
+	}
+
+	cores := make([]*CPUInfo, len(nowCores))
+
+	for i, now := range nowCores {
+
+		if now != nil && i < len(f.CoresRaw) && f.CoresRaw[i] != nil && f.CoresRaw[i].Total != 0 {
+			usage := cpuUsage(*f.CoresRaw[i], *now)
+			cores[i] = &usage
+		}
 	}
 
 	f.CPURaw = nowCPU
+	f.CoresRaw = nowCores
+	f.Cores = cores
 
 	return nil
 }
+
+// parseCPURaw parses the fields of a cpu line from /proc/stat
+func parseCPURaw(fields []string) CPURaw {
+
+	var raw CPURaw
+
+	for i := 1; i < len(fields); i++ {
+
+		val, err := strconv.ParseUint(fields[i], 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		raw.Total += val
+		switch i {
+		case 1:
+			raw.User = val
+		case 2:
+			raw.Nice = val
+		case 3:
+			raw.System = val
+		case 4:
+			raw.Idle = val
+		case 5:
+			raw.Iowait = val
+		case 6:
+			raw.Irq = val
+		case 7:
+			raw.SoftIrq = val
+		case 8:
+			raw.Steal = val
+		case 9:
+			raw.Guest = val
+		}
+	}
+
+	return raw
+}
+
+// cpuUsage computes the percent of time spent in each mode between two readings
+func cpuUsage(pre, now CPURaw) CPUInfo {
+
+	total := delta(pre.Total, now.Total)
+
+	if total <= 0 {
+		return CPUInfo{Total: now.Total}
+	}
+
+	return CPUInfo{
+		Total:   now.Total,
+		User:    delta(pre.User, now.User) / total * 100,
+		Nice:    delta(pre.Nice, now.Nice) / total * 100,
+		System:  delta(pre.System, now.System) / total * 100,
+		Idle:    delta(pre.Idle, now.Idle) / total * 100,
+		Iowait:  delta(pre.Iowait, now.Iowait) / total * 100,
+		Irq:     delta(pre.Irq, now.Irq) / total * 100,
+		SoftIrq: delta(pre.SoftIrq, now.SoftIrq) / total * 100,
+		Steal:   delta(pre.Steal, now.Steal) / total * 100,
+		Guest:   delta(pre.Guest, now.Guest) / total * 100,
+	}
+}
+
+// delta returns now - pre, or 0 if the counter went backwards.
+// The kernel does not guarantee iowait only increases.
+func delta(pre, now uint64) float32 {
+	if now < pre {
+		return 0
+	}
+	return float32(now - pre)
+}
+
+// Used is the percent of time not spent idle or waiting for I/O
+func (c CPUInfo) Used() float32 {
+	return 100 - c.Idle - c.Iowait
+}
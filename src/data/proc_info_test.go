@@ -0,0 +1,75 @@
+package data
+
+import (
+	"mitosu/src/shell"
+	"testing"
+)
+
+// procStat is /proc/stat of a host with 4 cores where cpu2 is offline
+const procStat = `cpu  400 0 200 1400 0 0 0 0 0 0
+cpu0 100 0 50 350 0 0 0 0 0 0
+cpu1 100 0 50 350 0 0 0 0 0 0
+cpu3 200 0 100 700 0 0 0 0 0 0
+intr 123456
+ctxt 7890
+btime 1700000000
+`
+
+// procStatLater is procStat after cpu0 was fully busy, cpu1 idle, and cpu2 came online
+const procStatLater = `cpu  600 0 200 1600 0 0 0 0 0 0
+cpu0 200 0 50 350 0 0 0 0 0 0
+cpu1 100 0 50 450 0 0 0 0 0 0
+cpu2 10 0 10 80 0 0 0 0 0 0
+cpu3 300 0 100 800 0 0 0 0 0 0
+intr 123456
+`
+
+func TestProcInfoCores(t *testing.T) {
+
+	f := &ProcInfoSystemStat{}
+	f.ParseCmdOutput(shell.PosixShellType, []string{"", "", "", "", procStat})
+
+	if len(f.CoresRaw) != 4 {
+		t.Fatalf("got %d raw cores, want 4", len(f.CoresRaw))
+	}
+
+	if f.CoresRaw[2] != nil {
+		t.Errorf("offline cpu2 has raw counters %+v", *f.CoresRaw[2])
+	}
+
+	if f.CoresRaw[3] == nil || f.CoresRaw[3].User != 200 || f.CoresRaw[3].Total != 1000 {
+		t.Errorf("cpu3 was not parsed into its own index: %+v", f.CoresRaw[3])
+	}
+
+	for i, core := range f.Cores {
+		if core != nil {
+			t.Errorf("cpu%d has a usage %+v without a previous sample", i, *core)
+		}
+	}
+
+	f.ParseCmdOutput(shell.PosixShellType, []string{"", "", "", "", procStatLater})
+
+	if len(f.Cores) != 4 {
+		t.Fatalf("got %d cores, want 4", len(f.Cores))
+	}
+
+	if f.Cores[0] == nil || f.Cores[0].Used() != 100 {
+		t.Errorf("cpu0 was busy the whole time, got %+v", f.Cores[0])
+	}
+
+	if f.Cores[1] == nil || f.Cores[1].Used() != 0 {
+		t.Errorf("cpu1 was idle the whole time, got %+v", f.Cores[1])
+	}
+
+	if f.Cores[2] != nil {
+		t.Errorf("cpu2 came online and has no previous sample, got %+v", *f.Cores[2])
+	}
+
+	if f.Cores[3] == nil || f.Cores[3].User != 50 || f.Cores[3].Idle != 50 {
+		t.Errorf("cpu3 was half busy, got %+v", f.Cores[3])
+	}
+
+	if f.CPU.User != 50 {
+		t.Errorf("the total user time is %v, want 50", f.CPU.User)
+	}
+}
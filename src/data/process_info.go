@@ -0,0 +1,415 @@
+package data
+
+import (
+	"bufio"
+	"mitosu/src/shell"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+type ProcessSort int
+
+var (
+	ProcessSortCPU ProcessSort = 0
+	ProcessSortMem ProcessSort = 1
+)
+
+const (
+	DefaultProcessLimit = 10
+)
+
+// MarshalText writes the sort as "cpu" or "mem" in the JSON output
+func (p ProcessSort) MarshalText() ([]byte, error) {
+
+	if p == ProcessSortMem {
+		return []byte("mem"), nil
+	}
+
+	return []byte("cpu"), nil
+}
+
+type ProcessInfo struct {
+	PID     int     `json:"pid"`
+	User    string  `json:"user"`
+	State   string  `json:"state"`
+	CPU     float32 `json:"cpu_percent"` // percent of a single core used since the last poll
+	RSS     uint64  `json:"rss"`
+	Threads int     `json:"threads"`
+	Command string  `json:"command"`
+
+	ticks uint64
+}
+
+type ProcessSystemStat struct {
+
+	// Limit is the number of processes kept in TopCPU and TopMem
+	Limit int `json:"limit"`
+
+	// SortBy is which list is shown
+	SortBy ProcessSort `json:"sort_by"`
+
+	TopCPU []ProcessInfo `json:"top_cpu"`
+	TopMem []ProcessInfo `json:"top_mem"`
+
+	prevTicks map[int]uint64
+	prevTotal uint64
+}
+
+func (f *ProcessSystemStat) Name() string {
+	return "processes"
+}
+
+func (f *ProcessSystemStat) CmdCount(sh shell.ShellType) int {
+	switch sh {
+
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+		return 6
+	}
+	return 0
+}
+
+func (f *ProcessSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
+
+	cmds := make([]shell.ShellCmd, f.CmdCount(sh))
+
+	switch sh {
+
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+
+		cmds[0].Cmd = "grep '^cpu' /proc/stat"
+		cmds[1].Cmd = "cat /proc/[0-9]*/stat 2>/dev/null"
+		cmds[2].Cmd = "grep -H -e '^Uid:' -e '^VmRSS:' /proc/[0-9]*/status 2>/dev/null"
+		cmds[3].Cmd = "head -c 256 /proc/[0-9]*/cmdline 2>/dev/null"
+		cmds[4].Cmd = "cat /etc/passwd"
+
+		// only when there is no procfs
+		cmds[5].Cmd = "[ -r /proc/self/stat ] || ps -eo pid=,user=,stat=,rss=,pcpu=,nlwp=,args="
+	}
+
+	return cmds
+}
+
+func (f *ProcessSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
+
+	if len(outs) < 6 {
+		log.Debug().Msg("Cannot parse processes, because the outputs was truncated")
+		return
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultProcessLimit
+	}
+
+	var procs []ProcessInfo
+
+	if strings.TrimSpace(outs[5]) != "" {
+
+		procs = parsePs(outs[5])
+
+	} else {
+
+		total, ncpu := parseCPUTotal(outs[0])
+
+		procs = parseProcStat(outs[1])
+		status := parseProcStatus(outs[2])
+		cmdlines := parseProcCmdline(outs[3])
+		users := parsePasswd(outs[4])
+
+		ticks := make(map[int]uint64, len(procs))
+
+		for i := range procs {
+
+			p := &procs[i]
+
+			if st, ok := status[p.PID]; ok {
+
+				p.RSS = st.rss
+
+				if name, ok := users[st.uid]; ok {
+					p.User = name
+				} else {
+					p.User = st.uid
+				}
+			}
+
+			if cmdline, ok := cmdlines[p.PID]; ok && cmdline != "" {
+				p.Command = cmdline
+			}
+
+			ticks[p.PID] = p.ticks
+
+			if pre, ok := f.prevTicks[p.PID]; ok && f.prevTotal != 0 && total > f.prevTotal && p.ticks >= pre {
+
+				// the total is for every core, so this is the percent of a single core like top shows
+				p.CPU = float32(p.ticks-pre) / float32(total-f.prevTotal) * float32(ncpu) * 100
+			}
+		}
+
+		f.prevTicks = ticks
+		f.prevTotal = total
+	}
+
+	f.TopCPU = topProcesses(procs, f.Limit, func(a, b *ProcessInfo) bool {
+		if a.CPU != b.CPU {
+			return a.CPU > b.CPU
+		}
+		return a.RSS > b.RSS
+	})
+
+	f.TopMem = topProcesses(procs, f.Limit, func(a, b *ProcessInfo) bool {
+		if a.RSS != b.RSS {
+			return a.RSS > b.RSS
+		}
+		return a.CPU > b.CPU
+	})
+}
+
+// Top returns the processes for the SortBy
+func (f *ProcessSystemStat) Top() []ProcessInfo {
+
+	if f.SortBy == ProcessSortMem {
+		return f.TopMem
+	}
+
+	return f.TopCPU
+}
+
+func topProcesses(procs []ProcessInfo, limit int, less func(a, b *ProcessInfo) bool) []ProcessInfo {
+
+	sorted := make([]ProcessInfo, len(procs))
+	copy(sorted, procs)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(&sorted[i], &sorted[j])
+	})
+
+	return sorted[:min(limit, len(sorted))]
+}
+
+// parseCPUTotal returns the total jiffies of all cores and the number of cores from the cpu lines of /proc/stat
+func parseCPUTotal(lines string) (uint64, int) {
+
+	var total uint64
+	ncpu := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(lines))
+
+	for scanner.Scan() {
+
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "cpu" {
+			total = parseCPURaw(fields).Total
+		} else if strings.HasPrefix(fields[0], "cpu") {
+			ncpu++
+		}
+	}
+
+	return total, max(ncpu, 1)
+}
+
+// parseProcStat parses the concatenated /proc/[pid]/stat files.
+// The command name is in parentheses and can contain spaces, so the fields are found after the last ')'.
+func parseProcStat(lines string) []ProcessInfo {
+
+	procs := make([]ProcessInfo, 0)
+
+	scanner := bufio.NewScanner(strings.NewReader(lines))
+
+	for scanner.Scan() {
+
+		line := scanner.Text()
+
+		open := strings.Index(line, " (")
+		end := strings.LastIndex(line, ") ")
+
+		if open == -1 || end == -1 || end < open {
+			continue
+		}
+
+		pid, err := strconv.Atoi(line[:open])
+
+		if err != nil {
+			continue
+		}
+
+		// fields starting from the 3rd field, state
+		fields := strings.Fields(line[end+2:])
+
+		if len(fields) < 18 {
+			continue
+		}
+
+		utime, _ := strconv.ParseUint(fields[11], 10, 64)
+		stime, _ := strconv.ParseUint(fields[12], 10, 64)
+		threads, _ := strconv.Atoi(fields[17])
+
+		procs = append(procs, ProcessInfo{
+			PID:     pid,
+			State:   fields[0],
+			Threads: threads,
+			Command: "[" + line[open+2:end] + "]",
+			ticks:   utime + stime,
+		})
+	}
+
+	return procs
+}
+
+type procStatus struct {
+	uid string
+	rss uint64
+}
+
+// parseProcStatus parses lines like '/proc/1/status:Uid:	0	0	0	0' from grep
+func parseProcStatus(lines string) map[int]procStatus {
+
+	status := make(map[int]procStatus)
+
+	scanner := bufio.NewScanner(strings.NewReader(lines))
+
+	for scanner.Scan() {
+
+		line := strings.TrimPrefix(scanner.Text(), "/proc/")
+
+		pidStr, rest, ok := strings.Cut(line, "/status:")
+
+		if !ok {
+			continue
+		}
+
+		pid, err := strconv.Atoi(pidStr)
+
+		if err != nil {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+
+		if len(fields) < 2 {
+			continue
+		}
+
+		st := status[pid]
+
+		switch fields[0] {
+		case "Uid:":
+			st.uid = fields[1]
+		case "VmRSS:":
+			if kb, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				st.rss = kb * 1024
+			}
+		}
+
+		status[pid] = st
+	}
+
+	return status
+}
+
+// parseProcCmdline parses the output of head on many /proc/[pid]/cmdline files,
+// which are separated by '==> /proc/[pid]/cmdline <==' headers and have nul separated arguments
+func parseProcCmdline(out string) map[int]string {
+
+	cmdlines := make(map[int]string)
+
+	for chunk := range strings.SplitSeq("\n"+out, "\n==> /proc/") {
+
+		header, content, ok := strings.Cut(chunk, "/cmdline <==\n")
+
+		if !ok {
+			continue
+		}
+
+		pid, err := strconv.Atoi(header)
+
+		if err != nil {
+			continue
+		}
+
+		// the arguments are nul separated, and can contain newlines which would break the output
+		cmdlines[pid] = strings.TrimSpace(strings.Map(func(r rune) rune {
+			if r < ' ' {
+				return ' '
+			}
+			return r
+		}, content))
+	}
+
+	return cmdlines
+}
+
+// parsePasswd maps uid to user name from /etc/passwd
+func parsePasswd(lines string) map[string]string {
+
+	users := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(lines))
+
+	for scanner.Scan() {
+
+		parts := strings.Split(scanner.Text(), ":")
+
+		if len(parts) < 3 {
+			continue
+		}
+
+		if _, ok := users[parts[2]]; !ok {
+			users[parts[2]] = parts[0]
+		}
+	}
+
+	return users
+}
+
+// parsePs parses 'ps -eo pid=,user=,stat=,rss=,pcpu=,nlwp=,args=', the CPU is the average over the life of the process
+func parsePs(lines string) []ProcessInfo {
+
+	procs := make([]ProcessInfo, 0)
+
+	scanner := bufio.NewScanner(strings.NewReader(lines))
+
+	for scanner.Scan() {
+
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) < 7 {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[0])
+
+		if err != nil {
+			continue
+		}
+
+		rss, _ := strconv.ParseUint(fields[3], 10, 64)
+		cpu, _ := strconv.ParseFloat(fields[4], 32)
+		threads, _ := strconv.Atoi(fields[5])
+
+		procs = append(procs, ProcessInfo{
+			PID:     pid,
+			User:    fields[1],
+			State:   fields[2],
+			RSS:     rss * 1024,
+			CPU:     float32(cpu),
+			Threads: threads,
+			Command: strings.Join(fields[6:], " "),
+		})
+	}
+
+	return procs
+}
@@ -0,0 +1,63 @@
+package data
+
+import (
+	"time"
+)
+
+const (
+	// SchemaVersion is the version of the JSON output described by schema/mitosu.schema.json.
+	// It goes up when a field is removed or changes meaning, adding a field keeps the version.
+	SchemaVersion = 1
+)
+
+// Report is the JSON output for a single host, the stats are keyed by their Name
+type Report struct {
+	SchemaVersion int                   `json:"schema_version"`
+	Host          string                `json:"host"`
+	Timestamp     time.Time             `json:"timestamp"`
+	Error         string                `json:"error,omitempty"`
+	Stats         map[string]SystemStat `json:"stats"`
+}
+
+// NewReport creates the report for a host, a host which failed has the error and no stats
+func NewReport(host string, timestamp time.Time, stats []SystemStat, err error) Report {
+
+	r := Report{
+		SchemaVersion: SchemaVersion,
+		Host:          host,
+		Timestamp:     timestamp.UTC(),
+		Stats:         make(map[string]SystemStat, len(stats)),
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+
+	for _, stat := range stats {
+		r.Stats[stat.Name()] = stat
+	}
+
+	return r
+}
+
+// Reports is the JSON output for several hosts, the reports are keyed by their Host
+type Reports struct {
+	SchemaVersion int               `json:"schema_version"`
+	Hosts         map[string]Report `json:"hosts"`
+}
+
+// NewReports keys the reports by their host
+func NewReports(reports []Report) Reports {
+
+	r := Reports{
+		SchemaVersion: SchemaVersion,
+		Hosts:         make(map[string]Report, len(reports)),
+	}
+
+	for _, report := range reports {
+		r.Hosts[report.Host] = report
+	}
+
+	return r
+}
@@ -0,0 +1,266 @@
+package data
+
+import (
+	"bufio"
+	"math"
+	"mitosu/src/shell"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Sensor struct {
+	// Chip is the hwmon name like coretemp, or the type of the thermal zone like x86_pkg_temp
+	Chip string `json:"chip"`
+
+	// Name is like temp1 or fan2, or the thermal zone like thermal_zone0
+	Name string `json:"name"`
+
+	// Label is like "Package id 0", it is the Name when the sensor has no label
+	Label string `json:"label"`
+
+	Kind string `json:"kind"` // temperature or fan
+
+	// Value is in degrees Celsius or RPM, the thresholds are 0 when not known
+	Value float64 `json:"value"`
+	High  float64 `json:"high"`
+	Crit  float64 `json:"crit"`
+	Min   float64 `json:"min"` // the lowest speed of a fan
+}
+
+// OverHigh is true when the temperature is at or above its high threshold, or the fan is below its minimum
+func (s Sensor) OverHigh() bool {
+
+	if s.Kind == "fan" {
+		return s.Min > 0 && s.Value < s.Min
+	}
+
+	return s.High > 0 && s.Value >= s.High
+}
+
+// OverCrit is true when the temperature is at or above its critical threshold
+func (s Sensor) OverCrit() bool {
+	return s.Crit > 0 && s.Value >= s.Crit
+}
+
+type SensorsSystemStat struct {
+	Sensors []Sensor `json:"sensors"`
+}
+
+func (f *SensorsSystemStat) Name() string {
+	return "sensors"
+}
+
+func (f *SensorsSystemStat) CmdCount(sh shell.ShellType) int {
+	switch sh {
+
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+		return 1
+	}
+	return 0
+}
+
+// sensorsCmd prints path:value for every sensor file, the globs which match nothing are ignored
+const sensorsCmd = "grep -H . " +
+	"/sys/class/hwmon/hwmon*/name " +
+	"/sys/class/hwmon/hwmon*/temp*_input /sys/class/hwmon/hwmon*/temp*_label " +
+	"/sys/class/hwmon/hwmon*/temp*_max /sys/class/hwmon/hwmon*/temp*_crit " +
+	"/sys/class/hwmon/hwmon*/fan*_input /sys/class/hwmon/hwmon*/fan*_label /sys/class/hwmon/hwmon*/fan*_min " +
+	"/sys/class/thermal/thermal_zone*/type /sys/class/thermal/thermal_zone*/temp " +
+	"/sys/class/thermal/thermal_zone*/trip_point_*_type /sys/class/thermal/thermal_zone*/trip_point_*_temp " +
+	"2>/dev/null"
+
+func (f *SensorsSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
+
+	var cmd shell.ShellCmd
+
+	switch sh {
+	default:
+	case shell.PosixShellType:
+
+		cmd.Cmd = sensorsCmd
+		cmd.Stdin = nil
+	}
+
+	return []shell.ShellCmd{cmd}
+}
+
+func (f *SensorsSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
+
+	f.Sensors = make([]Sensor, 0)
+
+	if len(outs) < 1 {
+		log.Debug().Msg("Cannot parse sensors because no output")
+		return
+	}
+
+	// the files of each hwmon or thermal zone directory
+	dirs := make(map[string]map[string]string)
+	order := make([]string, 0)
+
+	scanner := bufio.NewScanner(strings.NewReader(outs[0]))
+
+	for scanner.Scan() {
+
+		file, value, ok := strings.Cut(scanner.Text(), ":")
+
+		if !ok {
+			continue
+		}
+
+		dir, name := path.Split(file)
+
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]string)
+			order = append(order, dir)
+		}
+
+		dirs[dir][name] = strings.TrimSpace(value)
+	}
+
+	hwmonChips := make(map[string]bool)
+	zones := make([]string, 0)
+
+	for _, dir := range order {
+
+		if strings.Contains(dir, "/thermal_zone") {
+			zones = append(zones, dir)
+			continue
+		}
+
+		files := dirs[dir]
+		chip := files["name"]
+		hwmonChips[chip] = true
+
+		sensors := make([]Sensor, 0)
+
+		for name, value := range files {
+
+			input, ok := strings.CutSuffix(name, "_input")
+
+			if !ok {
+				continue
+			}
+
+			sensor := Sensor{Chip: chip, Name: input, Label: input, Kind: "temperature"}
+
+			if label := files[input+"_label"]; label != "" {
+				sensor.Label = label
+			}
+
+			// temperatures are in millidegrees
+			scale := 1000.0
+
+			if strings.HasPrefix(input, "fan") {
+				sensor.Kind = "fan"
+				scale = 1
+			}
+
+			sensor.Value = parseSensorValue(value, scale)
+			sensor.High = parseSensorValue(files[input+"_max"], scale)
+			sensor.Crit = parseSensorValue(files[input+"_crit"], scale)
+			sensor.Min = parseSensorValue(files[input+"_min"], scale)
+
+			sensors = append(sensors, sensor)
+		}
+
+		// temp2 before temp10
+		sort.Slice(sensors, func(i, j int) bool { return sensorLess(sensors[i].Name, sensors[j].Name) })
+
+		f.Sensors = append(f.Sensors, sensors...)
+	}
+
+	for _, dir := range zones {
+
+		files := dirs[dir]
+		chip := files["type"]
+
+		// thermal zones are often also registered as a hwmon with the same name
+		if hwmonChips[strings.ReplaceAll(chip, "-", "_")] {
+			continue
+		}
+
+		value, ok := files["temp"]
+
+		if !ok {
+			continue
+		}
+
+		name := path.Base(dir)
+
+		sensor := Sensor{
+			Chip:  chip,
+			Name:  name,
+			Label: name,
+			Kind:  "temperature",
+			Value: parseSensorValue(value, 1000),
+		}
+
+		// the trip points are where the kernel starts cooling, hot is before critical.
+		// The lowest of each type is used, a zone can have several.
+		trips := make(map[string]float64)
+
+		for file, tripType := range files {
+
+			trip, ok := strings.CutSuffix(file, "_type")
+
+			if !ok || !strings.HasPrefix(trip, "trip_point_") {
+				continue
+			}
+
+			temp := parseSensorValue(files[trip+"_temp"], 1000)
+
+			if temp <= 0 {
+				continue
+			}
+
+			if lowest, ok := trips[tripType]; !ok || temp < lowest {
+				trips[tripType] = temp
+			}
+		}
+
+		sensor.Crit = trips["critical"]
+
+		// passive cooling starts before hot, it is only used when there is no hot trip point
+		sensor.High = trips["hot"]
+		if sensor.High == 0 {
+			sensor.High = trips["passive"]
+		}
+
+		f.Sensors = append(f.Sensors, sensor)
+	}
+}
+
+// parseSensorValue returns 0 when the value is missing or not a number
+func parseSensorValue(s string, scale float64) float64 {
+
+	n, err := strconv.ParseFloat(s, 64)
+
+	if err != nil {
+		return 0
+	}
+
+	return math.Round(n/scale*10) / 10
+}
+
+// sensorLess sorts names like temp10 after temp2
+func sensorLess(a, b string) bool {
+
+	aPrefix := strings.TrimRight(a, "0123456789")
+	bPrefix := strings.TrimRight(b, "0123456789")
+
+	if aPrefix != bPrefix {
+		return aPrefix > bPrefix // temp before fan
+	}
+
+	an, _ := strconv.Atoi(a[len(aPrefix):])
+	bn, _ := strconv.Atoi(b[len(bPrefix):])
+
+	return an < bn
+}
@@ -0,0 +1,365 @@
+package data
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"mitosu/src/shell"
+	"net"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+type SocketProcess struct {
+	Name string `json:"name"`
+	PID  int    `json:"pid"`
+}
+
+type ListenSocket struct {
+	Protocol string `json:"protocol"` // tcp or udp
+	Address  string `json:"address"`  // like 0.0.0.0 or ::, * when ss does not show it
+	Port     int    `json:"port"`
+
+	// Processes are only known with ss, and only for the processes of the user unless run as root
+	Processes []SocketProcess `json:"processes"`
+}
+
+type SocketsSystemStat struct {
+	Listening []ListenSocket `json:"listening"`
+
+	// TCPStates counts the TCP sockets by state, like ESTABLISHED, TIME_WAIT or CLOSE_WAIT
+	TCPStates map[string]int `json:"tcp_states"`
+	TCPTotal  int            `json:"tcp_total"`
+
+	// TCPOrphaned are the sockets no process holds anymore, it is only known from ss -s
+	TCPOrphaned int `json:"tcp_orphaned"`
+
+	// EphemeralPorts is the size of the local port range outgoing connections are given ports from
+	EphemeralPorts int `json:"ephemeral_ports"`
+
+	// Source is "ss", or "proc" when read from /proc/net because ss is not installed
+	Source string `json:"source"`
+}
+
+// TCPStateOrder is the order the TCP states are shown in, the kernel names them like this
+var TCPStateOrder = []string{
+	"ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING", "NEW_SYN_RECV",
+}
+
+// EphemeralUsedPerc is the percent of the local port range used by TCP sockets which are not listening.
+// Connections to different destinations can share a port, so it is the worst case.
+func (f *SocketsSystemStat) EphemeralUsedPerc() float32 {
+
+	if f.EphemeralPorts == 0 {
+		return 0
+	}
+
+	used := f.TCPTotal - f.TCPStates["LISTEN"]
+
+	return float32(float64(used) / float64(f.EphemeralPorts) * 100)
+}
+
+func (f *SocketsSystemStat) Name() string {
+	return "sockets"
+}
+
+func (f *SocketsSystemStat) CmdCount(sh shell.ShellType) int {
+	switch sh {
+
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+		return 3
+	}
+	return 0
+}
+
+// socketsListenCmd prints how it was read on the first line, then the listening sockets of ss,
+// or every socket in /proc/net when ss is not installed. For /proc/net the first line also has
+// the byte order of the host, 0001 when little endian and 0100 when big endian.
+const socketsListenCmd = `if command -v ss >/dev/null 2>&1; then
+echo ss
+ss -tulpnH
+else
+echo "proc $(printf '\001\000' | od -An -tx2)"
+grep -H . /proc/net/tcp /proc/net/tcp6 /proc/net/udp /proc/net/udp6 2>/dev/null
+fi`
+
+// socketsStatesCmd prints the summary of ss followed by lines like '12 state ESTAB', nothing without ss
+const socketsStatesCmd = `command -v ss >/dev/null 2>&1 && { ss -s; ss -tanH | awk '{print "state", $1}' | sort | uniq -c; }`
+
+func (f *SocketsSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
+
+	cmds := make([]shell.ShellCmd, f.CmdCount(sh))
+
+	switch sh {
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+
+		cmds[0].Cmd = socketsListenCmd
+		cmds[1].Cmd = socketsStatesCmd
+		cmds[2].Cmd = "cat /proc/sys/net/ipv4/ip_local_port_range"
+	}
+
+	return cmds
+}
+
+func (f *SocketsSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
+
+	f.Listening = make([]ListenSocket, 0)
+	f.TCPStates = make(map[string]int)
+	f.TCPTotal = 0
+	f.TCPOrphaned = 0
+
+	if len(outs) < 3 {
+		log.Debug().Msg("Cannot parse sockets because no output")
+		return
+	}
+
+	header, out, _ := strings.Cut(strings.TrimLeft(outs[0], "\n"), "\n")
+	fields := strings.Fields(header)
+
+	f.Source = ""
+	if len(fields) > 0 {
+		f.Source = fields[0]
+	}
+
+	switch f.Source {
+	case "ss":
+		f.parseSS(out)
+		f.parseSSStates(outs[1])
+	case "proc":
+		var order binary.ByteOrder = binary.LittleEndian
+
+		if len(fields) > 1 && fields[1] == "0100" {
+			order = binary.BigEndian
+		}
+
+		f.parseProc(out, order)
+	default:
+		log.Debug().Msg("Cannot read sockets")
+		f.Source = ""
+	}
+
+	sort.SliceStable(f.Listening, func(i, j int) bool {
+
+		a, b := f.Listening[i], f.Listening[j]
+
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.Port < b.Port
+	})
+
+	f.EphemeralPorts = 0
+
+	if fields := strings.Fields(outs[2]); len(fields) == 2 {
+
+		low, errLow := strconv.Atoi(fields[0])
+		high, errHigh := strconv.Atoi(fields[1])
+
+		if errLow == nil && errHigh == nil && high >= low {
+			f.EphemeralPorts = high - low + 1
+		}
+	}
+}
+
+// ssProcessRe matches the processes ss shows like users:(("sshd",pid=812,fd=3),("sshd",pid=901,fd=3))
+var ssProcessRe = regexp.MustCompile(`\("([^"]*)",pid=(\d+)`)
+
+// parseSS parses lines like 'tcp LISTEN 0 4096 127.0.0.53%lo:53 0.0.0.0:* users:(("systemd-resolve",pid=512,fd=14))'
+func (f *SocketsSystemStat) parseSS(out string) {
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) < 5 {
+			continue
+		}
+
+		local := fields[4]
+		i := strings.LastIndex(local, ":")
+
+		if i < 0 {
+			continue
+		}
+
+		port, err := strconv.Atoi(local[i+1:])
+
+		if err != nil {
+			continue
+		}
+
+		// the interface is after a %, like [fe80::1%eth0] or 127.0.0.53%lo
+		address, _, _ := strings.Cut(local[:i], "%")
+
+		socket := ListenSocket{
+			Protocol:  fields[0],
+			Address:   strings.Trim(address, "[]"),
+			Port:      port,
+			Processes: make([]SocketProcess, 0),
+		}
+
+		for _, m := range ssProcessRe.FindAllStringSubmatch(strings.Join(fields[5:], " "), -1) {
+			pid, _ := strconv.Atoi(m[2])
+			socket.Processes = append(socket.Processes, SocketProcess{Name: m[1], PID: pid})
+		}
+
+		f.Listening = append(f.Listening, socket)
+	}
+}
+
+// ssStates maps the states ss shows to the names of the kernel, the others only have - instead of _
+var ssStates = map[string]string{
+	"ESTAB":      "ESTABLISHED",
+	"FIN-WAIT-1": "FIN_WAIT1",
+	"FIN-WAIT-2": "FIN_WAIT2",
+	"UNCONN":     "CLOSE",
+}
+
+// parseSSStates parses 'TCP:   6 (estab 2, closed 0, orphaned 0, timewait 0)' from ss -s and the counted states
+func (f *SocketsSystemStat) parseSSStates(out string) {
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+
+		if len(fields) == 3 && fields[1] == "state" {
+
+			n, _ := strconv.Atoi(fields[0])
+
+			state, ok := ssStates[fields[2]]
+			if !ok {
+				state = strings.ReplaceAll(fields[2], "-", "_")
+			}
+
+			f.TCPStates[state] += n
+			f.TCPTotal += n
+			continue
+		}
+
+		if !strings.HasPrefix(line, "TCP:") {
+			continue
+		}
+
+		_, counts, _ := strings.Cut(line, "(")
+
+		for _, count := range strings.Split(strings.TrimSuffix(counts, ")"), ",") {
+
+			name, value, _ := strings.Cut(strings.TrimSpace(count), " ")
+
+			if name == "orphaned" {
+				f.TCPOrphaned, _ = strconv.Atoi(value)
+			}
+		}
+	}
+}
+
+// procTCPStates are the states in /proc/net/tcp, which are in hex
+var procTCPStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+	"0C": "NEW_SYN_RECV",
+}
+
+// parseProc parses lines like '/proc/net/tcp:   0: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 ...'
+func (f *SocketsSystemStat) parseProc(out string, order binary.ByteOrder) {
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+
+		file, line, ok := strings.Cut(scanner.Text(), ":")
+
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		// the header line is 'sl local_address rem_address st ...'
+		if len(fields) < 4 || fields[0] == "sl" {
+			continue
+		}
+
+		protocol := strings.TrimSuffix(path.Base(file), "6")
+		state := fields[3]
+
+		if protocol == "tcp" {
+
+			name, ok := procTCPStates[state]
+			if !ok {
+				name = state
+			}
+
+			f.TCPStates[name]++
+			f.TCPTotal++
+		}
+
+		// udp sockets which are bound but not connected are shown as 07, like ss -l does
+		if !(protocol == "tcp" && state == "0A") && !(protocol == "udp" && state == "07") {
+			continue
+		}
+
+		hexAddress, hexPort, ok := strings.Cut(fields[1], ":")
+
+		if !ok {
+			continue
+		}
+
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+
+		if err != nil {
+			continue
+		}
+
+		f.Listening = append(f.Listening, ListenSocket{
+			Protocol:  protocol,
+			Address:   parseProcAddress(hexAddress, order),
+			Port:      int(port),
+			Processes: make([]SocketProcess, 0),
+		})
+	}
+}
+
+// parseProcAddress parses the hex address of /proc/net, which is in 32 bit words in the byte order of the host
+func parseProcAddress(s string, order binary.ByteOrder) string {
+
+	b, err := hex.DecodeString(s)
+
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return s
+	}
+
+	ip := make(net.IP, len(b))
+
+	for i := 0; i < len(b); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], order.Uint32(b[i:]))
+	}
+
+	return ip.String()
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"fmt"
+	"mitosu/src/shell"
+	"testing"
+)
+
+const ssListen = `ss
+udp   UNCONN 0      0         127.0.0.53%lo:53        0.0.0.0:*    users:(("systemd-resolve",pid=512,fd=13))
+tcp   LISTEN 0      4096            0.0.0.0:22        0.0.0.0:*    users:(("sshd",pid=812,fd=3),("sshd",pid=901,fd=3))
+tcp   LISTEN 0      511                [::]:80           [::]:*
+tcp   LISTEN 0      128       [fe80::1%eth0]:8080        [::]:*
+`
+
+const ssSummary = `Total: 180
+TCP:   9 (estab 5, closed 1, orphaned 2, timewait 1)
+
+Transport Total     IP        IPv6
+RAW	  0         0         0
+TCP	  8         5         3
+      5 state ESTAB
+      1 state TIME-WAIT
+      1 state FIN-WAIT-1
+      2 state LISTEN
+`
+
+func TestSocketsSS(t *testing.T) {
+
+	f := &SocketsSystemStat{}
+	f.ParseCmdOutput(shell.PosixShellType, []string{ssListen, ssSummary, "32768\t60999\n"})
+
+	if f.Source != "ss" || len(f.Listening) != 4 {
+		t.Fatalf("got %s %+v", f.Source, f.Listening)
+	}
+
+	want := []string{"tcp 0.0.0.0:22", "tcp :::80", "tcp fe80::1:8080", "udp 127.0.0.53:53"}
+
+	for i, s := range f.Listening {
+		if got := fmt.Sprintf("%s %s:%d", s.Protocol, s.Address, s.Port); got != want[i] {
+			t.Errorf("socket %d is %s, want %s", i, got, want[i])
+		}
+	}
+
+	if p := f.Listening[0].Processes; len(p) != 2 || p[0].Name != "sshd" || p[1].PID != 901 {
+		t.Errorf("the processes of sshd %+v", p)
+	}
+
+	if f.TCPStates["ESTABLISHED"] != 5 || f.TCPStates["TIME_WAIT"] != 1 || f.TCPStates["FIN_WAIT1"] != 1 || f.TCPTotal != 9 {
+		t.Errorf("states %v total %d", f.TCPStates, f.TCPTotal)
+	}
+
+	if f.TCPOrphaned != 2 || f.EphemeralPorts != 28232 {
+		t.Errorf("orphaned %d ephemeral ports %d", f.TCPOrphaned, f.EphemeralPorts)
+	}
+}
+
+// procNet has 127.0.0.1:3306 and [::1]:5432 listening, an established connection and 0.0.0.0:68 bound for udp
+const procNet = `%s
+/proc/net/tcp:  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+/proc/net/tcp:   0: %s:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 1234 1 0 100 0 0 10 0
+/proc/net/tcp:   1: %s:0CEA %s:D431 01 00000000:00000000 00:00000000 00000000   999        0 1235 1 0 20 4 30 10 -1
+/proc/net/tcp6:  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+/proc/net/tcp6:   0: %s:1538 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 1236 1 0 100 0 0 10 0
+/proc/net/udp:   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+/proc/net/udp:   12: 00000000:0044 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 1237 2 0 0
+`
+
+func TestSocketsProc(t *testing.T) {
+
+	for _, order := range []struct {
+		header, loopback, loopback6 string
+	}{
+		{"proc  0001", "0100007F", "00000000000000000000000001000000"},
+		{"proc  0100", "7F000001", "00000000000000000000000000000001"},
+	} {
+
+		out := fmt.Sprintf(procNet, order.header, order.loopback, order.loopback, order.loopback, order.loopback6)
+
+		f := &SocketsSystemStat{}
+		f.ParseCmdOutput(shell.PosixShellType, []string{out, "", "32768 60999"})
+
+		if f.Source != "proc" || len(f.Listening) != 3 {
+			t.Fatalf("%s: got %s %+v", order.header, f.Source, f.Listening)
+		}
+
+		want := []string{"tcp 127.0.0.1:3306", "tcp ::1:5432", "udp 0.0.0.0:68"}
+
+		for i, s := range f.Listening {
+			if got := fmt.Sprintf("%s %s:%d", s.Protocol, s.Address, s.Port); got != want[i] {
+				t.Errorf("%s: socket %d is %s, want %s", order.header, i, got, want[i])
+			}
+		}
+
+		if f.TCPStates["LISTEN"] != 2 || f.TCPStates["ESTABLISHED"] != 1 || f.TCPTotal != 3 {
+			t.Errorf("%s: states %v total %d", order.header, f.TCPStates, f.TCPTotal)
+		}
+	}
+}
@@ -6,6 +6,9 @@ import (
 
 type SystemStat interface {
 
+	// Name is the key of the stat in the JSON output
+	Name() string
+
 	// CmdCount returns the number of commands for this shell type
 	CmdCount(sh shell.ShellType) int
 
@@ -15,3 +18,11 @@ type SystemStat interface {
 	// ParseCmdOutput parses the result of running the commands from GetCmds(sh)
 	ParseCmdOutput(sh shell.ShellType, out []string)
 }
+
+// StaticStat is a stat which does not change while connected, like the OS version.
+// It has no commands once collected, until it is Reset after connecting again.
+type StaticStat interface {
+	SystemStat
+
+	Reset()
+}
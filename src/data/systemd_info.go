@@ -0,0 +1,277 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"mitosu/src/shell"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+type SystemdUnit struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Load        string `json:"load"`
+	Active      string `json:"active"`
+	Sub         string `json:"sub"`
+	Result      string `json:"result"` // why the unit last stopped, like exit-code, it is success otherwise
+	Restarts    int    `json:"restarts"`
+
+	// the accounting is 0 when it is turned off for the unit
+	MemoryBytes uint64  `json:"memory_bytes"`
+	CPUSeconds  float64 `json:"cpu_seconds"`
+	CPUPercent  float32 `json:"cpu_percent"` // since the last poll, 100 is one full core
+}
+
+type SystemdSystemStat struct {
+	// Running is false when the host was not booted with systemd, so there are no units
+	Running bool `json:"running"`
+
+	Failed []SystemdUnit `json:"failed"`
+
+	// Watched are the Units which were asked for, in the same order
+	Watched []SystemdUnit `json:"units"`
+
+	// Units are the names of the units to watch, like nginx.service
+	Units []string `json:"-"`
+
+	prevCPU    map[string]float64
+	prevUptime float64
+}
+
+func (f *SystemdSystemStat) Name() string {
+	return "systemd"
+}
+
+func (f *SystemdSystemStat) CmdCount(sh shell.ShellType) int {
+	switch sh {
+
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+		return 3
+	}
+	return 0
+}
+
+// systemdShowProps are the properties systemctl show prints for each unit
+const systemdShowProps = "Id,Description,LoadState,ActiveState,SubState,Result,NRestarts,MemoryCurrent,CPUUsageNSec"
+
+func (f *SystemdSystemStat) GetCmds(sh shell.ShellType) []shell.ShellCmd {
+
+	cmds := make([]shell.ShellCmd, f.CmdCount(sh))
+
+	switch sh {
+	default:
+		log.Panic().Int("shellType", int(sh)).Msg("Unknown shell type given")
+
+	case shell.PosixShellType:
+
+		units := make([]string, 0, len(f.Units))
+		for _, unit := range f.Units {
+			units = append(units, shell.Quote(unit))
+		}
+
+		// the first line is systemd when it is running, systemd older than 246 has no JSON output
+		cmds[0].Cmd = "[ -d /run/systemd/system ] && echo systemd && " +
+			"{ systemctl list-units --failed --output=json --no-pager 2>/dev/null || systemctl list-units --failed --plain --no-legend --no-pager; }"
+
+		// the failed units are shown too, for their restarts and result
+		cmds[1].Cmd = "systemctl show --no-pager -p " + systemdShowProps + " -- " + strings.Join(units, " ") +
+			" $(systemctl list-units --failed --plain --no-legend --no-pager 2>/dev/null | sed 's/^● *//' | awk '{print $1}')"
+
+		cmds[2].Cmd = "cat /proc/uptime"
+	}
+
+	return cmds
+}
+
+func (f *SystemdSystemStat) ParseCmdOutput(sh shell.ShellType, outs []string) {
+
+	f.Failed = make([]SystemdUnit, 0)
+	f.Watched = make([]SystemdUnit, 0, len(f.Units))
+
+	if len(outs) < 3 {
+		log.Debug().Msg("Cannot parse systemd units because no output")
+		return
+	}
+
+	header, failed, _ := strings.Cut(strings.TrimLeft(outs[0], "\n"), "\n")
+	f.Running = strings.TrimSpace(header) == "systemd"
+
+	if !f.Running {
+		log.Debug().Msg("Host is not running systemd")
+		return
+	}
+
+	f.parseFailed(failed)
+
+	shown := parseSystemdShow(outs[1])
+
+	uptime := 0.0
+	if fields := strings.Fields(outs[2]); len(fields) > 0 {
+		uptime, _ = strconv.ParseFloat(fields[0], 64)
+	}
+
+	elapsed := uptime - f.prevUptime
+	nowCPU := make(map[string]float64, len(shown))
+
+	for name, unit := range shown {
+
+		nowCPU[name] = unit.CPUSeconds
+
+		if pre, ok := f.prevCPU[name]; ok && elapsed > 0 && unit.CPUSeconds >= pre {
+			unit.CPUPercent = float32((unit.CPUSeconds - pre) / elapsed * 100)
+			shown[name] = unit
+		}
+	}
+
+	f.prevCPU = nowCPU
+	f.prevUptime = uptime
+
+	for i, failed := range f.Failed {
+
+		if unit, ok := shown[failed.Name]; ok {
+			f.Failed[i] = unit
+		}
+	}
+
+	for _, name := range f.Units {
+
+		unit, ok := shown[name]
+
+		// systemctl show adds .service when it is left out
+		if !ok {
+			unit, ok = shown[name+".service"]
+		}
+
+		if !ok {
+			unit = SystemdUnit{Name: name, Load: "not-found"}
+		}
+
+		f.Watched = append(f.Watched, unit)
+	}
+}
+
+// parseFailed parses the JSON from systemctl list-units, or its plain text lines like
+// 'nginx.service loaded failed failed A high performance web server'
+func (f *SystemdSystemStat) parseFailed(out string) {
+
+	out = strings.TrimSpace(out)
+
+	if strings.HasPrefix(out, "[") {
+
+		var units []struct {
+			Unit        string `json:"unit"`
+			Load        string `json:"load"`
+			Active      string `json:"active"`
+			Sub         string `json:"sub"`
+			Description string `json:"description"`
+		}
+
+		if err := json.Unmarshal([]byte(out), &units); err != nil {
+			log.Debug().Err(err).Msg("failed to parse systemd failed units")
+			return
+		}
+
+		for _, u := range units {
+			f.Failed = append(f.Failed, SystemdUnit{Name: u.Unit, Load: u.Load, Active: u.Active, Sub: u.Sub, Description: u.Description})
+		}
+
+		return
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+
+		// some versions show a bullet before failed units even with --plain
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "●"))
+
+		if len(fields) < 4 {
+			continue
+		}
+
+		f.Failed = append(f.Failed, SystemdUnit{
+			Name:        fields[0],
+			Load:        fields[1],
+			Active:      fields[2],
+			Sub:         fields[3],
+			Description: strings.Join(fields[4:], " "),
+		})
+	}
+}
+
+// parseSystemdShow parses the Key=Value blocks from systemctl show, which are separated by empty lines
+func parseSystemdShow(out string) map[string]SystemdUnit {
+
+	units := make(map[string]SystemdUnit)
+
+	var unit SystemdUnit
+
+	add := func() {
+		if unit.Name != "" {
+			units[unit.Name] = unit
+		}
+		unit = SystemdUnit{}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+
+		line := scanner.Text()
+
+		if strings.TrimSpace(line) == "" {
+			add()
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Id":
+			unit.Name = value
+		case "Description":
+			unit.Description = value
+		case "LoadState":
+			unit.Load = value
+		case "ActiveState":
+			unit.Active = value
+		case "SubState":
+			unit.Sub = value
+		case "Result":
+			unit.Result = value
+		case "NRestarts":
+			unit.Restarts, _ = strconv.Atoi(value)
+		case "MemoryCurrent":
+			unit.MemoryBytes = systemdCounter(value)
+		case "CPUUsageNSec":
+			unit.CPUSeconds = float64(systemdCounter(value)) / 1e9
+		}
+	}
+
+	add()
+
+	return units
+}
+
+// systemdCounter is 0 for "[not set]" and the max uint64 which systemd shows when accounting is off
+func systemdCounter(s string) uint64 {
+
+	n, err := strconv.ParseUint(s, 10, 64)
+
+	if err != nil || n == math.MaxUint64 {
+		return 0
+	}
+
+	return n
+}
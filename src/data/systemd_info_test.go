@@ -0,0 +1,108 @@
+package data
+
+import (
+	"mitosu/src/shell"
+	"testing"
+)
+
+const systemdFailedJSON = `systemd
+[{"unit":"backup.service","load":"loaded","active":"failed","sub":"failed","description":"Nightly backup"}]
+`
+
+const systemdFailedPlain = `systemd
+● backup.service loaded failed failed Nightly backup
+`
+
+const systemdShow = `Id=nginx.service
+Description=A high performance web server
+LoadState=loaded
+ActiveState=active
+SubState=running
+Result=success
+NRestarts=2
+MemoryCurrent=52428800
+CPUUsageNSec=3000000000
+
+Id=backup.service
+Description=Nightly backup
+LoadState=loaded
+ActiveState=failed
+SubState=failed
+Result=exit-code
+NRestarts=0
+MemoryCurrent=[not set]
+CPUUsageNSec=18446744073709551615
+`
+
+const systemdShowLater = `Id=nginx.service
+Description=A high performance web server
+LoadState=loaded
+ActiveState=active
+SubState=running
+Result=success
+NRestarts=2
+MemoryCurrent=52428800
+CPUUsageNSec=8000000000
+`
+
+func TestSystemdFailed(t *testing.T) {
+
+	for name, failed := range map[string]string{"json": systemdFailedJSON, "plain": systemdFailedPlain} {
+
+		f := &SystemdSystemStat{Units: []string{"nginx", "missing.service"}}
+		f.ParseCmdOutput(shell.PosixShellType, []string{failed, systemdShow, "100.00 400.00"})
+
+		if !f.Running || len(f.Failed) != 1 {
+			t.Fatalf("%s: got %+v", name, f.Failed)
+		}
+
+		// the failed unit is shown by systemctl show too, for its result
+		if u := f.Failed[0]; u.Name != "backup.service" || u.Description != "Nightly backup" || u.Result != "exit-code" {
+			t.Errorf("%s: failed unit %+v", name, u)
+		}
+
+		if u := f.Failed[0]; u.MemoryBytes != 0 || u.CPUSeconds != 0 {
+			t.Errorf("%s: accounting is off for the backup %+v", name, u)
+		}
+	}
+}
+
+func TestSystemdWatched(t *testing.T) {
+
+	f := &SystemdSystemStat{Units: []string{"nginx", "missing.service"}}
+	f.ParseCmdOutput(shell.PosixShellType, []string{"systemd\n", systemdShow, "100.00 400.00"})
+
+	if len(f.Failed) != 0 || len(f.Watched) != 2 {
+		t.Fatalf("got failed %+v and watched %+v", f.Failed, f.Watched)
+	}
+
+	nginx := f.Watched[0]
+
+	if nginx.Name != "nginx.service" || nginx.Active != "active" || nginx.Restarts != 2 || nginx.MemoryBytes != 50*1024*1024 || nginx.CPUSeconds != 3 {
+		t.Errorf("nginx is found without .service %+v", nginx)
+	}
+
+	if nginx.CPUPercent != 0 {
+		t.Errorf("the first poll has no CPU percent, got %v", nginx.CPUPercent)
+	}
+
+	if missing := f.Watched[1]; missing.Name != "missing.service" || missing.Load != "not-found" {
+		t.Errorf("a unit systemctl did not show %+v", missing)
+	}
+
+	f.ParseCmdOutput(shell.PosixShellType, []string{"systemd\n", systemdShowLater, "110.00 440.00"})
+
+	if nginx := f.Watched[0]; nginx.CPUPercent != 50 {
+		t.Errorf("nginx used 5 seconds of CPU in 10 seconds, got %v", nginx.CPUPercent)
+	}
+}
+
+func TestSystemdNotRunning(t *testing.T) {
+
+	f := &SystemdSystemStat{Units: []string{"nginx"}}
+	f.ParseCmdOutput(shell.PosixShellType, []string{"", "", "100.00 400.00"})
+
+	if f.Running || len(f.Failed) != 0 || len(f.Watched) != 0 {
+		t.Errorf("a host without systemd %+v", f)
+	}
+}
@@ -96,3 +96,14 @@ func BlueBold(s string) string {
 func MagentaBold(s string) string {
 	return ColorBold(s, colorMagenta)
 }
+
+// LevelColor colors s green, yellow or red depending on how high the percent p is
+func LevelColor(s string, p float32) string {
+	switch {
+	case p >= 90:
+		return Redbold(s)
+	case p >= 70:
+		return Yellow(s)
+	}
+	return Green(s)
+}
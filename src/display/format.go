@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"time"
 )
 
 func FmtByteU64(b uint64, align int) string {
@@ -21,6 +22,39 @@ func FmtPercent(p float32, align int) string {
 	return fmt.Sprintf("%*s%%", align, fmt.Sprintf("%.1f", p))
 }
 
+// FmtBar draws a bar like [||||      ] which is p percent full
+func FmtBar(p float32, width int) string {
+
+	fill := int(math.Round(float64(p) / 100 * float64(width)))
+	fill = max(0, min(fill, width))
+
+	return "[" + strings.Repeat("|", fill) + strings.Repeat(" ", width-fill) + "]"
+}
+
+// FmtDuration shows the two largest units of d, like 3d 4h or 5m 12s
+func FmtDuration(d time.Duration) string {
+
+	d = max(d, 0)
+
+	parts := []struct {
+		n    int
+		unit string
+	}{
+		{int(d.Hours()) / 24, "d"},
+		{int(d.Hours()) % 24, "h"},
+		{int(d.Minutes()) % 60, "m"},
+		{int(d.Seconds()) % 60, "s"},
+	}
+
+	for i, p := range parts {
+		if p.n > 0 && i < len(parts)-1 {
+			return fmt.Sprintf("%d%s %d%s", p.n, p.unit, parts[i+1].n, parts[i+1].unit)
+		}
+	}
+
+	return fmt.Sprintf("%ds", parts[len(parts)-1].n)
+}
+
 func LPad(s string, pad int) string {
 	if len(s) >= pad {
 		return s
@@ -64,6 +64,12 @@ type VirtualTerm struct {
 	Lines        []string
 	SupportsAnsi bool
 
+	// OnKey is called from Input with every key which is not used for navigating
+	OnKey func(key []byte)
+
+	// Hint is shown after the navigation help at the bottom of the screen
+	Hint string
+
 	lineBuffer  bytes.Buffer
 	inputBuffer [32]byte
 	truncBuffer []rune
@@ -183,7 +189,7 @@ func (p *VirtualTerm) Redraw() {
 			fmt.Print(p.truncateANSI(line, p.Width-1))
 			fmt.Print("\r\n")
 		}
-		fmt.Print("q to quit, arrow keys or hjkl to navigate\r\n")
+		fmt.Print("q to quit, arrow keys or hjkl to navigate" + p.Hint + "\r\n")
 	}
 }
 
@@ -251,6 +257,12 @@ func (p *VirtualTerm) Input() error {
 			p.YOffset++
 			p.Redraw()
 		}
+
+	default:
+
+		if p.OnKey != nil {
+			p.OnKey(bytes.Clone(buf))
+		}
 	}
 
 	return nil
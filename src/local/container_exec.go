@@ -0,0 +1,44 @@
+package local
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NewDockerExec runs the commands inside a running container with 'docker exec', as root it uses the container's root user
+func NewDockerExec(container string) *LocalExecutor {
+
+	return &LocalExecutor{
+		Prefix:     []string{"docker", "exec", "-i", container},
+		RootPrefix: []string{"docker", "exec", "-i", "-u", "0", container},
+	}
+}
+
+// NewKubectlExec runs the commands inside a pod with 'kubectl exec'.
+// The pod is given as 'namespace/pod', 'namespace/pod/container' or just 'pod' for the current namespace.
+func NewKubectlExec(pod string) (*LocalExecutor, error) {
+
+	parts := strings.Split(pod, "/")
+
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("Invalid pod '%s', expected namespace/pod or namespace/pod/container", pod)
+		}
+	}
+
+	args := []string{"kubectl", "exec", "-i"}
+
+	switch len(parts) {
+	case 1:
+		args = append(args, parts[0])
+	case 2:
+		args = append(args, "-n", parts[0], parts[1])
+	case 3:
+		args = append(args, "-n", parts[0], parts[1], "-c", parts[2])
+	default:
+		return nil, fmt.Errorf("Invalid pod '%s', expected namespace/pod or namespace/pod/container", pod)
+	}
+
+	// kubectl cannot choose the user, so running as root needs sudo inside the pod
+	return &LocalExecutor{Prefix: append(args, "--")}, nil
+}
@@ -0,0 +1,138 @@
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"mitosu/src/shell"
+	"mitosu/src/ssh"
+	"os/exec"
+	"os/user"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LocalExecutor runs commands on the machine mitosu runs on, in the same way SSHClient runs them remotely.
+// With a Prefix the shell is started through another command like 'docker exec -i', so the commands run inside a container.
+type LocalExecutor struct {
+	SudoRequiresPassword bool
+	Password             string
+	CanPrompt            bool
+
+	// Prefix is the command the shell is started with, the shell runs directly when it is empty
+	Prefix []string
+
+	// RootPrefix is used instead of sudo to run the shell as root, like 'docker exec -u 0'
+	RootPrefix []string
+
+	// WithRoot is set when the commands will run as root, the sudo password is only asked for then
+	WithRoot bool
+}
+
+// Connect does nothing, there is nothing to connect to
+func (l *LocalExecutor) Connect() error {
+	return nil
+}
+
+func (l *LocalExecutor) Connected() bool {
+	return true
+}
+
+func (l *LocalExecutor) Close() error {
+	return nil
+}
+
+func (l *LocalExecutor) PromptRootPass() error {
+
+	if l.WithRoot && l.RootPrefix == nil && l.SudoRequiresPassword && l.Password == "" {
+
+		if !l.CanPrompt {
+			return fmt.Errorf("Root shell requires sudo password: %w", ssh.ErrUserEmptyPassword)
+		}
+
+		name := "you"
+		if usr, err := user.Current(); err == nil {
+			name = usr.Username
+		}
+
+		pass, err := ssh.PromptForPasswordF("Enter %s's sudo password: ", name)
+
+		if err != nil {
+			return fmt.Errorf("Root shell requires sudo password: %w", err)
+		}
+
+		l.Password = string(pass)
+	}
+
+	return nil
+}
+
+func (l *LocalExecutor) RunCommands(withRoot bool, sh shell.Shell, commands []shell.ShellCmd) ([]string, error) {
+
+	log.Debug().
+		Int("shell", int(sh.GetType())).
+		Interface("command", commands).
+		Msg("Running local command")
+
+	// the shell commands are single words like 'sudo -S sh', so they are split on spaces
+	args := append(slices.Clone(l.Prefix), strings.Fields(sh.Sh())...)
+	sendPassword := false
+
+	if withRoot {
+
+		l.WithRoot = true
+
+		if l.RootPrefix != nil {
+
+			args = append(slices.Clone(l.RootPrefix), strings.Fields(sh.Sh())...)
+
+		} else {
+
+			if err := l.PromptRootPass(); err != nil {
+				return nil, err
+			}
+
+			args = append(slices.Clone(l.Prefix), strings.Fields(sh.RootSh(l.SudoRequiresPassword))...)
+			sendPassword = l.SudoRequiresPassword
+		}
+	}
+
+	log.Debug().Strs("args", args).Msg("Starting local shell")
+
+	cmd := exec.Command(args[0], args[1:]...)
+
+	var buf bytes.Buffer
+	var bufErr bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &bufErr
+
+	stdin, err := cmd.StdinPipe()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	if sendPassword {
+		fmt.Fprintln(stdin, l.Password)
+	}
+
+	sep := shell.NewSeparator()
+
+	shell.WriteCommands(stdin, sh, sep, commands)
+	stdin.Close()
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(bufErr.String()))
+	}
+
+	stdout := buf.String()
+
+	log.Debug().Str("stderr", bufErr.String()).Str("stdout", stdout).Msg("Got local output")
+
+	return shell.SplitOutput(stdout, sep, len(commands)), nil
+}
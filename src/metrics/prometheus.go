@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type MetricType string
+
+var (
+	Gauge   MetricType = "gauge"
+	Counter MetricType = "counter"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family is every sample of a single metric, in the Prometheus text format they must be written together
+type Family struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	Samples []Sample
+}
+
+// Registry collects samples into families, keeping the order the families were first seen in
+type Registry struct {
+	families []*Family
+	index    map[string]*Family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make([]*Family, 0),
+		index:    make(map[string]*Family),
+	}
+}
+
+// Add adds a sample to the named family, creating the family if this is the first sample for it
+func (r *Registry) Add(name string, typ MetricType, help string, value float64, labels ...Label) {
+
+	family, ok := r.index[name]
+
+	if !ok {
+		family = &Family{Name: name, Help: help, Type: typ}
+		r.index[name] = family
+		r.families = append(r.families, family)
+	}
+
+	family.Samples = append(family.Samples, Sample{Labels: labels, Value: value})
+}
+
+func (r *Registry) Families() []*Family {
+	return r.families
+}
+
+// WriteText writes every family in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+
+	for _, family := range r.families {
+
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family.Name, escapeHelp(family.Help), family.Name, family.Type); err != nil {
+			return err
+		}
+
+		for _, sample := range family.Samples {
+
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", family.Name, formatLabels(sample.Labels), formatValue(sample.Value)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func L(name, value string) Label {
+	return Label{Name: name, Value: value}
+}
+
+func formatLabels(labels []Label) string {
+
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteByte('{')
+
+	for i, label := range labels {
+
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString(label.Name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(label.Value))
+		b.WriteByte('"')
+	}
+
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+func formatValue(v float64) string {
+
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"mitosu/src/data"
+	"strings"
+)
+
+const (
+	// userHZ is the kernel clock tick used by /proc/stat, it is 100 on practically every Linux system
+	userHZ = 100
+)
+
+// AddStats adds the metrics of every stat collected from host
+func AddStats(r *Registry, host string, stats []data.SystemStat) {
+
+	for _, stat := range stats {
+		AddStat(r, host, stat)
+	}
+}
+
+// AddStat adds the metrics of a single stat collected from host
+func AddStat(r *Registry, host string, stat data.SystemStat) {
+
+	h := L("host", host)
+
+	switch v := stat.(type) {
+
+	case *data.InventorySystemStat:
+
+		r.Add("mitosu_os_info", Gauge, "OS and kernel of the host, always 1.", 1, h, L("os_id", v.OSID), L("os_version", v.OSVersion), L("os_name", v.OSName), L("kernel", v.Kernel), L("arch", v.Arch))
+		r.Add("mitosu_hardware_info", Gauge, "CPU and virtualization of the host, always 1.", 1, h, L("cpu_model", v.CPUModel), L("virtualization", v.Virtualization), L("vendor", v.Vendor), L("product", v.Product))
+		r.Add("mitosu_cpu_threads", Gauge, "Number of CPU threads.", float64(v.CPUThreads), h)
+		r.Add("mitosu_cpu_cores", Gauge, "Number of physical CPU cores.", float64(v.CPUCores), h)
+
+		if !v.BootTime.IsZero() {
+			r.Add("mitosu_boot_time_seconds", Gauge, "Unix time the host booted.", float64(v.BootTime.Unix()), h)
+		}
+
+	case *data.ProcInfoSystemStat:
+
+		r.Add("mitosu_uptime_seconds", Gauge, "Time since the host booted.", v.Uptime.Seconds(), h)
+
+		r.Add("mitosu_load1", Gauge, "1 minute load average.", v.Load1, h)
+		r.Add("mitosu_load5", Gauge, "5 minute load average.", v.Load5, h)
+		r.Add("mitosu_load15", Gauge, "15 minute load average.", v.Load15, h)
+
+		r.Add("mitosu_procs_running", Gauge, "Number of runnable processes.", float64(v.RunningProcs), h)
+		r.Add("mitosu_procs_total", Gauge, "Number of processes and threads.", float64(v.TotalProcs), h)
+
+		r.Add("mitosu_memory_total_bytes", Gauge, "Total usable memory.", float64(v.MemTotal), h)
+		r.Add("mitosu_memory_free_bytes", Gauge, "Unused memory.", float64(v.MemFree), h)
+		r.Add("mitosu_memory_buffers_bytes", Gauge, "Memory used by kernel buffers.", float64(v.MemBuffers), h)
+		r.Add("mitosu_memory_cached_bytes", Gauge, "Memory used by the page cache.", float64(v.MemCached), h)
+		r.Add("mitosu_swap_total_bytes", Gauge, "Total swap space.", float64(v.SwapTotal), h)
+		r.Add("mitosu_swap_free_bytes", Gauge, "Unused swap space.", float64(v.SwapFree), h)
+		r.Add("mitosu_memory_available_bytes", Gauge, "Memory available without swapping.", float64(v.MemAvailable), h)
+		r.Add("mitosu_memory_shmem_bytes", Gauge, "Shared memory and tmpfs.", float64(v.MemShmem), h)
+		r.Add("mitosu_memory_slab_bytes", Gauge, "Memory used by the kernel slab allocator.", float64(v.MemSlab), h)
+		r.Add("mitosu_memory_slab_reclaimable_bytes", Gauge, "Slab memory which can be reclaimed.", float64(v.MemSReclaimable), h)
+		r.Add("mitosu_memory_dirty_bytes", Gauge, "Memory waiting to be written to disk.", float64(v.MemDirty), h)
+		r.Add("mitosu_memory_writeback_bytes", Gauge, "Memory being written to disk.", float64(v.MemWriteback), h)
+		r.Add("mitosu_memory_commit_limit_bytes", Gauge, "Memory which can be allocated before overcommitting.", float64(v.CommitLimit), h)
+		r.Add("mitosu_memory_committed_bytes", Gauge, "Memory allocated by processes.", float64(v.CommittedAS), h)
+		r.Add("mitosu_memory_hugepages_total", Gauge, "Number of huge pages.", float64(v.HugePagesTotal), h)
+		r.Add("mitosu_memory_hugepages_free", Gauge, "Number of unused huge pages.", float64(v.HugePagesFree), h)
+		r.Add("mitosu_memory_hugepage_size_bytes", Gauge, "Size of a huge page.", float64(v.HugePageSize), h)
+
+		pressures := []struct {
+			resource string
+			pressure *data.Pressure
+		}{
+			{"cpu", v.Pressure.CPU},
+			{"memory", v.Pressure.Memory},
+			{"io", v.Pressure.IO},
+		}
+
+		for _, p := range pressures {
+
+			if p.pressure == nil {
+				continue
+			}
+
+			r.Add("mitosu_pressure_stalled_seconds_total", Counter, "Time some or all tasks were stalled on the resource.", float64(p.pressure.Some.Total)/1e6, h, L("resource", p.resource), L("kind", "some"))
+			r.Add("mitosu_pressure_stalled_seconds_total", Counter, "Time some or all tasks were stalled on the resource.", float64(p.pressure.Full.Total)/1e6, h, L("resource", p.resource), L("kind", "full"))
+		}
+
+		if v.CPURaw.Total != 0 {
+
+			modes := []struct {
+				mode string
+				val  uint64
+			}{
+				{"user", v.CPURaw.User},
+				{"nice", v.CPURaw.Nice},
+				{"system", v.CPURaw.System},
+				{"idle", v.CPURaw.Idle},
+				{"iowait", v.CPURaw.Iowait},
+				{"irq", v.CPURaw.Irq},
+				{"softirq", v.CPURaw.SoftIrq},
+				{"steal", v.CPURaw.Steal},
+				{"guest", v.CPURaw.Guest},
+			}
+
+			for _, m := range modes {
+				r.Add("mitosu_cpu_seconds_total", Counter, "Seconds the CPUs spent in each mode.", float64(m.val)/userHZ, h, L("mode", m.mode))
+			}
+		}
+
+	case *data.FSSystemStat:
+
+		for _, fs := range v.FSInfos {
+
+			labels := []Label{h, L("filesystem", fs.Filesystem), L("mountpoint", fs.MountPoint), L("type", strings.ToLower(fs.Type.String()))}
+
+			r.Add("mitosu_filesystem_size_bytes", Gauge, "Filesystem size.", float64(fs.Used+fs.Free), labels...)
+			r.Add("mitosu_filesystem_used_bytes", Gauge, "Filesystem space used.", float64(fs.Used), labels...)
+			r.Add("mitosu_filesystem_free_bytes", Gauge, "Filesystem space available to non-root users.", float64(fs.Free), labels...)
+		}
+
+	case *data.NetIntfSystemStat:
+
+		for name, intf := range v.NetIntf {
+
+			labels := []Label{h, L("interface", name)}
+
+			r.Add("mitosu_network_receive_bytes_total", Counter, "Bytes received by the interface.", float64(intf.Rx), labels...)
+			r.Add("mitosu_network_transmit_bytes_total", Counter, "Bytes transmitted by the interface.", float64(intf.Tx), labels...)
+			r.Add("mitosu_network_receive_packets_total", Counter, "Packets received by the interface.", float64(intf.Counters.RxPackets), labels...)
+			r.Add("mitosu_network_transmit_packets_total", Counter, "Packets transmitted by the interface.", float64(intf.Counters.TxPackets), labels...)
+			r.Add("mitosu_network_receive_errors_total", Counter, "Receive errors on the interface.", float64(intf.Counters.RxErrs), labels...)
+			r.Add("mitosu_network_transmit_errors_total", Counter, "Transmit errors on the interface.", float64(intf.Counters.TxErrs), labels...)
+			r.Add("mitosu_network_receive_drop_total", Counter, "Received packets dropped by the interface.", float64(intf.Counters.RxDrop), labels...)
+			r.Add("mitosu_network_transmit_drop_total", Counter, "Transmitted packets dropped by the interface.", float64(intf.Counters.TxDrop), labels...)
+			r.Add("mitosu_network_info", Gauge, "Addresses of the interface, always 1.", 1, h, L("interface", name), L("ipv4", intf.IPv4), L("ipv6", intf.IPv6), L("address", intf.MAC), L("operstate", strings.ToLower(intf.OperState)))
+			r.Add("mitosu_network_mtu_bytes", Gauge, "MTU of the interface.", float64(intf.MTU), labels...)
+
+			if intf.Speed > 0 {
+				r.Add("mitosu_network_speed_bytes", Gauge, "Link speed of the interface in bytes per second.", float64(intf.Speed)*1000*1000/8, labels...)
+			}
+
+			for _, addr := range intf.Addrs {
+				r.Add("mitosu_network_address_info", Gauge, "Every address of the interface, always 1.", 1, h, L("interface", name), L("family", addr.Family), L("address", addr.String()), L("scope", addr.Scope))
+			}
+		}
+
+	case *data.DockerSystemStat:
+
+		for _, ct := range v.DockerContainers {
+
+			labels := []Label{h, L("container", ct.Name), L("id", ct.ShortID()), L("runtime", ct.Runtime)}
+
+			r.Add("mitosu_container_cpu_percent", Gauge, "Container CPU usage, 100 is one full core.", float64(ct.CPU), labels...)
+			r.Add("mitosu_container_memory_usage_bytes", Gauge, "Container memory usage.", float64(ct.MemUsed), labels...)
+			r.Add("mitosu_container_memory_limit_bytes", Gauge, "Container memory limit.", float64(ct.MemTotal), labels...)
+			r.Add("mitosu_container_network_receive_bytes_total", Counter, "Bytes received by the container.", float64(ct.NetIn), labels...)
+			r.Add("mitosu_container_network_transmit_bytes_total", Counter, "Bytes transmitted by the container.", float64(ct.NetOut), labels...)
+			r.Add("mitosu_container_block_read_bytes_total", Counter, "Bytes read from block devices by the container.", float64(ct.BlockIn), labels...)
+			r.Add("mitosu_container_block_write_bytes_total", Counter, "Bytes written to block devices by the container.", float64(ct.BlockOut), labels...)
+			r.Add("mitosu_container_pids", Gauge, "Number of processes in the container.", float64(ct.PIDs), labels...)
+
+			if ct.State != "" {
+				r.Add("mitosu_container_info", Gauge, "State, health and image of the container, always 1.", 1, append(labels, L("state", ct.State), L("health", ct.Health), L("image", ct.Image))...)
+				r.Add("mitosu_container_exit_code", Gauge, "Exit code of the container when it last stopped.", float64(ct.ExitCode), labels...)
+			}
+
+			// docker stats and the other CLIs do not show restarts, crictl does
+			if v.Source == "api" || ct.Runtime == "crictl" {
+				r.Add("mitosu_container_restarts_total", Counter, "Times the container was restarted by docker.", float64(ct.RestartCount), labels...)
+
+				if !ct.StartedAt.IsZero() {
+					r.Add("mitosu_container_start_time_seconds", Gauge, "Start time of the container since unix epoch in seconds.", float64(ct.StartedAt.Unix()), labels...)
+				}
+			}
+		}
+	}
+}
@@ -10,3 +10,8 @@ func escapeSingleQuotes(s string) string {
 	}
 	return strings.ReplaceAll(s, "'", `'"'"'`)
 }
+
+// Quote quotes s as a single POSIX shell word
+func Quote(s string) string {
+	return "'" + escapeSingleQuotes(s) + "'"
+}
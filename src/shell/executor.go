@@ -0,0 +1,79 @@
+package shell
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Executor runs batches of commands on a host, over SSH or on the machine mitosu runs on
+type Executor interface {
+
+	// Connect connects to the host, it is called again to reconnect after an error
+	Connect() error
+
+	// Connected returns true once Connect has succeeded
+	Connected() bool
+
+	// PromptRootPass asks for the sudo password if running as root needs one and it was not given
+	PromptRootPass() error
+
+	// RunCommands runs the commands in a single shell, returning the output of each command.
+	// If withRoot is set the shell is elevated with sudo.
+	RunCommands(withRoot bool, sh Shell, commands []ShellCmd) ([]string, error)
+
+	Close() error
+}
+
+// NewSeparator returns a random line which is printed between the output of each command
+func NewSeparator() string {
+
+	var sepBytes [32]byte
+	rand.Read(sepBytes[:])
+
+	return fmt.Sprintf("[%x]\n", sepBytes)
+}
+
+// WriteCommands writes the preamble of the shell, then each command followed by the separator to the shell's stdin
+func WriteCommands(stdin io.Writer, sh Shell, sep string, commands []ShellCmd) error {
+
+	log.Debug().Str("cmd", sh.Preamble()).Msg("Running preamble")
+
+	if _, err := fmt.Fprintln(stdin, sh.Preamble()); err != nil {
+		return err
+	}
+
+	for _, shCmd := range commands {
+
+		cmd := sh.OrTrue(shCmd.Cmd)
+		log.Debug().Str("cmd", cmd).Msg("Running")
+
+		if _, err := fmt.Fprintln(stdin, cmd); err != nil {
+			return err
+		}
+
+		cmd = sh.Echo(sep)
+		log.Debug().Str("cmd", cmd).Msg("Running")
+
+		if _, err := fmt.Fprintln(stdin, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SplitOutput splits the output of the shell written to by WriteCommands into the output of each command
+func SplitOutput(stdout string, sep string, count int) []string {
+
+	results := strings.Split(stdout, sep)
+
+	if len(results) == count+1 {
+		results = results[0:count]
+	}
+
+	return results
+}
@@ -22,6 +22,11 @@ func (PosixShell) RootSh(canPromptPassword bool) string {
 	}
 }
 
+// Preamble sets the C locale, the collectors parse the output of tools like df whose headers are translated in other locales
+func (PosixShell) Preamble() string {
+	return "export LC_ALL=C"
+}
+
 func (PosixShell) Echo(s string) string {
 	return fmt.Sprintf("printf '%s'", escapeSingleQuotes(s))
 }
@@ -31,3 +36,7 @@ func (PosixShell) OrTrue(s string) string {
 	// Works even if s contains pipes or &&.
 	return fmt.Sprintf("( %s ) || true", s)
 }
+
+func (PosixShell) NoStdin(s string) string {
+	return fmt.Sprintf("( %s ) </dev/null", s)
+}
@@ -23,9 +23,15 @@ type Shell interface {
 	// If canPromptPassword is true, the command will be the platforms interactive `sudo -P sh` command, exppecting the root password on stdin.
 	RootSh(canPromptPassword bool) string
 
+	// Preamble returns the commands run before the others in every shell, they must not print anything
+	Preamble() string
+
 	// Echo returns the platforms 'echo' command echoing the given string
 	Echo(s string) string
 
 	// OrTrue appends a '|| true' to the command, making it never fail
 	OrTrue(s string) string
+
+	// NoStdin redirects the stdin of the command from nothing, so it cannot read the shell's input
+	NoStdin(s string) string
 }
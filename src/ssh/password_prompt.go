@@ -1,16 +1,58 @@
 package ssh
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 
 	"golang.org/x/term"
 )
 
+// promptMu stops prompts from different connections writing over each other
+var promptMu sync.Mutex
+
+// lineReaders are kept for each fd, so input buffered after a line is there for the next prompt.
+// They are only used while promptMu is held.
+var lineReaders = make(map[int]*bufio.Reader)
+
 func PromptForPasswordF(format string, args ...any) ([]byte, error) {
 
+	// the typed enter is not echoed, so the line is ended after it
+	return promptF(term.ReadPassword, true, format, args...)
+}
+
+// PromptForLineF is like PromptForPasswordF but echos the input back to the user
+func PromptForLineF(format string, args ...any) ([]byte, error) {
+
+	return promptF(func(fd int) ([]byte, error) {
+
+		r, ok := lineReaders[fd]
+
+		if !ok {
+			r = bufio.NewReader(os.NewFile(uintptr(fd), "/dev/stdin"))
+			lineReaders[fd] = r
+		}
+
+		line, err := r.ReadString('\n')
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(strings.TrimRight(line, "\r\n")), nil
+
+	}, false, format, args...)
+}
+
+func promptF(read func(fd int) ([]byte, error), newline bool, format string, args ...any) ([]byte, error) {
+
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 	defer signal.Stop(sig)
@@ -27,7 +69,7 @@ func PromptForPasswordF(format string, args ...any) ([]byte, error) {
 	errCh := make(chan error)
 	go func() {
 		fmt.Fprintf(os.Stderr, format, args...)
-		password, err := term.ReadPassword(in)
+		password, err := read(in)
 
 		if err != nil {
 			errCh <- err
@@ -38,7 +80,9 @@ func PromptForPasswordF(format string, args ...any) ([]byte, error) {
 
 	select {
 	case password := <-passCh:
-		fmt.Fprintln(os.Stderr)
+		if newline {
+			fmt.Fprintln(os.Stderr)
+		}
 		return password, nil
 	case err := <-errCh:
 		fmt.Fprintln(os.Stderr)
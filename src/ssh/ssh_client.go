@@ -2,12 +2,10 @@ package ssh
 
 import (
 	"bytes"
-	"crypto/rand"
 	"fmt"
+	"io"
 	"mitosu/src/shell"
-	"net"
-	"strconv"
-	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 	gossh "golang.org/x/crypto/ssh"
@@ -24,54 +22,154 @@ type SSHClient struct {
 	Config               Section
 	Passwords            SSHPasswords
 	SudoRequiresPassword bool
+	HostKeyChecking      HostKeyChecking
+
+	// Jumps are the ProxyJump hosts, connected through in order before Config
+	Jumps []Section
+
+	// KeepShell makes RunCommands reuse a single long lived shell instead of starting one for every call
+	KeepShell bool
+
+	jumpClients []*gossh.Client
+
+	// jumpPasswords are the passwords of each jump host, the passwords of Config are never sent to them
+	jumpPasswords []SSHPasswords
+
+	keptShell   *shellSession
+	keptShellMu sync.Mutex
 }
 
 func (s *SSHClient) Connect() error {
 
+	// the old connection is closed first, so a failed redial does not look connected
+	s.closeShell()
+
+	if s.Client != nil {
+		s.Client.Close()
+		s.Client = nil
+	}
+
+	s.closeJumps()
+
+	var prev *gossh.Client
+
+	// kept between connects, so a prompted password is not asked for again when reconnecting
+	if len(s.jumpPasswords) != len(s.Jumps) {
+
+		s.jumpPasswords = make([]SSHPasswords, len(s.Jumps))
+
+		for i := range s.jumpPasswords {
+			s.jumpPasswords[i].CanPrompt = s.Passwords.CanPrompt
+		}
+	}
+
+	for i, hop := range s.Jumps {
+
+		log.Debug().Str("host", sectionAddr(hop)).Str("user", hop.User).Msg("Connecting to jump host")
+
+		client, err := s.dial(prev, hop, &s.jumpPasswords[i])
+
+		if err != nil {
+			s.closeJumps()
+			return fmt.Errorf("jump host %s: %w", hop.Name, err)
+		}
+
+		s.jumpClients = append(s.jumpClients, client)
+		prev = client
+	}
+
+	client, err := s.dial(prev, s.Config, &s.Passwords)
+
+	if err != nil {
+		s.closeJumps()
+		return err
+	}
+
+	s.Client = client
+
+	return nil
+}
+
+// dial connects to the given section with its own passwords, if via is not nil the connection is tunneled through it
+func (s *SSHClient) dial(via *gossh.Client, section Section, pwds *SSHPasswords) (*gossh.Client, error) {
+
 	authMethods := make([]gossh.AuthMethod, 0, 3)
 
-	if m, err := GetKeyAuthMethod(s.Config.IdentityFile, &s.Passwords); err == nil {
+	if m, err := GetKeyAuthMethod(section.IdentityFile, pwds); err == nil {
 		authMethods = append(authMethods, m)
 	} else {
 		log.Debug().Err(err).Msg("Could not get key auth method")
 	}
 
-	if m, err := GetAgentAuthMethod(s.Config.User, s.Config.Hostname); err == nil {
+	if m, err := GetAgentAuthMethod(section.User, section.Hostname); err == nil {
 		authMethods = append(authMethods, m)
 	} else {
 		log.Debug().Err(err).Msg("Could not get ssh agent auth method")
 	}
 
-	m := GetPasswordAuthMethod(s.Config.User, s.Config.Hostname, &s.Passwords)
+	m := GetPasswordAuthMethod(section.User, section.Hostname, pwds)
 	authMethods = append(authMethods, m)
 
+	addr := sectionAddr(section)
+
+	hostKeyCallback, hostKeyAlgos, err := GetHostKeyCallback(section, addr, s.HostKeyChecking, pwds.CanPrompt)
+
+	if err != nil {
+		return nil, err
+	}
+
 	config := &gossh.ClientConfig{
-		User: s.Config.User,
-		Auth: authMethods,
-		HostKeyCallback: func(hostname string, _ net.Addr, _ gossh.PublicKey) error {
-			log.Debug().Str("host", hostname).Msg("Connecting to remote")
-			return nil
-		},
+		User:              section.User,
+		Auth:              authMethods,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgos,
 	}
 
-	addr := s.Config.Hostname + ":" + strconv.Itoa(s.Config.Port)
-	client, err := gossh.Dial("tcp", addr, config)
+	log.Debug().Str("host", addr).Msg("Connecting to remote")
+
+	if via == nil {
+		return gossh.Dial("tcp", addr, config)
+	}
+
+	conn, err := via.Dial("tcp", addr)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if s.Client != nil {
-		s.Client.Close()
+	c, chans, reqs, err := gossh.NewClientConn(conn, addr, config)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
 
-	s.Client = client
+	return gossh.NewClient(c, chans, reqs), nil
+}
 
-	return nil
+func (s *SSHClient) closeJumps() {
+
+	for i := len(s.jumpClients) - 1; i >= 0; i-- {
+		s.jumpClients[i].Close()
+	}
+
+	s.jumpClients = s.jumpClients[:0]
+}
+
+func (s *SSHClient) Connected() bool {
+	return s.Client != nil
 }
 
 func (s *SSHClient) Close() error {
-	s.Client.Close()
+
+	s.closeShell()
+
+	if s.Client != nil {
+		s.Client.Close()
+	}
+
+	s.closeJumps()
+
 	return nil
 }
 
@@ -119,6 +217,10 @@ func (s *SSHClient) RunCommand(command string) (string, error) {
 
 func (s *SSHClient) RunCommands(withRoot bool, sh shell.Shell, commands []shell.ShellCmd) ([]string, error) {
 
+	if s.KeepShell {
+		return s.runCommandsInShell(withRoot, sh, commands)
+	}
+
 	log.Debug().
 		Int("shell", int(sh.GetType())).
 		Interface("command", commands).
@@ -137,28 +239,48 @@ func (s *SSHClient) RunCommands(withRoot bool, sh shell.Shell, commands []shell.
 		return nil, err
 	}
 
-	var sepBytes [32]byte
-	rand.Read(sepBytes[:])
-	sep := fmt.Sprintf("[%x]\n", sepBytes)
+	sep := shell.NewSeparator()
 
 	var buf bytes.Buffer
 	var bufErr bytes.Buffer
 	session.Stdout = &buf
 	session.Stderr = &bufErr
 
-	var cmd string
+	if err := s.startShell(session, stdin, withRoot, sh); err != nil {
+		return nil, err
+	}
+
+	shell.WriteCommands(stdin, sh, sep, commands)
+	stdin.Close()
+
+	if err := session.Wait(); err != nil {
+		return nil, err
+	}
+
+	stdout := buf.String()
+	stderr := bufErr.String()
+
+	results := shell.SplitOutput(stdout, sep, len(commands))
+
+	log.Debug().Str("stderr", stderr).Str("stdout", stdout).Msg("Got SSH output")
+
+	return results, nil
+}
+
+// startShell starts the shell for running commands on the session, elevating it with sudo if withRoot is set
+func (s *SSHClient) startShell(session *gossh.Session, stdin io.Writer, withRoot bool, sh shell.Shell) error {
 
 	if withRoot {
 
 		if err := s.PromptRootPass(); err != nil {
-			return nil, err
+			return err
 		}
 
-		cmd = sh.RootSh(s.SudoRequiresPassword)
+		cmd := sh.RootSh(s.SudoRequiresPassword)
 		log.Error().Str("cmd", cmd).Bool("no-pass-sudo", !s.SudoRequiresPassword).Msg("Running root shell")
 
 		if err := session.Start(cmd); err != nil {
-			return nil, err
+			return err
 		}
 
 		if s.SudoRequiresPassword {
@@ -167,41 +289,14 @@ func (s *SSHClient) RunCommands(withRoot bool, sh shell.Shell, commands []shell.
 
 	} else {
 
-		cmd = sh.Sh()
+		cmd := sh.Sh()
 		log.Debug().Str("cmd", cmd).Msg("Running shell")
 
 		// none root shell
 		if err := session.Start(sh.Sh()); err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	for _, shCmd := range commands {
-
-		cmd = sh.OrTrue(shCmd.Cmd)
-		log.Debug().Str("cmd", cmd).Msg("Running")
-		fmt.Fprintln(stdin, cmd)
-
-		cmd = sh.Echo(sep)
-		log.Debug().Str("cmd", cmd).Msg("Running")
-		fmt.Fprintln(stdin, cmd)
-	}
-	stdin.Close()
-
-	if err := session.Wait(); err != nil {
-		return nil, err
-	}
-
-	stdout := buf.String()
-	stderr := bufErr.String()
-
-	results := strings.Split(stdout, sep)
-
-	if len(results) == len(commands)+1 {
-		results = results[0:len(commands)]
-	}
-
-	log.Debug().Str("stderr", stderr).Str("stdout", stdout).Msg("Got SSH output")
-
-	return results, nil
+	return nil
 }
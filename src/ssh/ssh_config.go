@@ -2,98 +2,592 @@ package ssh
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultPort = 22
+
+	// SystemConfigPath is read after the user config, so it's values only apply when the user config does not set them
+	SystemConfigPath = "/etc/ssh/ssh_config"
+
+	maxIncludeDepth = 16
+)
+
+var (
+	ErrIncludeDepth = errors.New("ssh config Include nested too deeply")
 )
 
+// cumulativeOptions can be given multiple times, every value is kept instead of only the first
+var cumulativeOptions = map[string]bool{
+	"identityfile":    true,
+	"certificatefile": true,
+	"localforward":    true,
+	"remoteforward":   true,
+	"dynamicforward":  true,
+	"sendenv":         true,
+	"setenv":          true,
+}
+
 type SSHConfig struct {
-	Path     string
-	Sections []Section
+	Path   string
+	Blocks []Block
+}
+
+// Block is a group of options which apply when all of it's conditions match.
+// Options before the first Host or Match have no conditions.
+// Blocks from an Include inside a Host or Match inherit the conditions of that block.
+type Block struct {
+	Conditions []Condition
+	Options    []Option
+}
+
+// Condition is either a Host line or a Match line
+type Condition struct {
+	Host    []string
+	Match   []MatchCriteria
+	IsMatch bool
+}
+
+type MatchCriteria struct {
+	Keyword string
+	Negate  bool
+	Arg     string
+}
+
+type Option struct {
+	Key    string
+	Values []string
 }
 
+// Section is the effective configuration for a single host
 type Section struct {
 	Name         string
 	Hostname     string
 	Port         int
 	User         string
 	IdentityFile string
+	ProxyJump    string
+
+	UserKnownHostsFile    []string
+	GlobalKnownHostsFile  []string
+	StrictHostKeyChecking string
 }
 
 func ParseConfig(path string) (*SSHConfig, error) {
 
+	cfg := SSHConfig{
+		Path:   path,
+		Blocks: []Block{},
+	}
+
+	if err := cfg.parseFile(path, filepath.Dir(path), nil, 0); err != nil {
+		return nil, err
+	}
+
+	if path != SystemConfigPath {
+
+		if err := cfg.parseFile(SystemConfigPath, filepath.Dir(SystemConfigPath), nil, 0); err != nil && !os.IsNotExist(err) {
+			log.Debug().Err(err).Str("path", SystemConfigPath).Msg("Could not read system ssh config")
+		}
+	}
+
+	return &cfg, nil
+}
+
+func (c *SSHConfig) parseFile(path string, includeDir string, parent []Condition, depth int) error {
+
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%w: %s", ErrIncludeDepth, path)
+	}
+
 	f, err := os.Open(path)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer f.Close()
 
-	cfg := SSHConfig{
-		Path:     path,
-		Sections: []Section{},
-	}
+	log.Debug().Str("path", path).Int("depth", depth).Msg("Reading ssh config")
 
-	var current []*Section
+	c.Blocks = append(c.Blocks, Block{Conditions: parent})
 
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
 
-		if line == "" || strings.HasPrefix(line, "#") {
+		key, args, err := splitConfigLine(scanner.Text())
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if key == "" || len(args) == 0 {
+			continue
+		}
+
+		switch key {
+		case "host":
+
+			c.Blocks = append(c.Blocks, Block{
+				Conditions: append(slices.Clone(parent), Condition{Host: args}),
+			})
+
+		case "match":
+
+			criteria, err := parseMatch(args)
+
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+
+			c.Blocks = append(c.Blocks, Block{
+				Conditions: append(slices.Clone(parent), Condition{Match: criteria, IsMatch: true}),
+			})
+
+		case "include":
+
+			current := c.Blocks[len(c.Blocks)-1].Conditions
+
+			for _, pattern := range args {
+
+				pattern = ExpandPath(pattern)
+
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(includeDir, pattern)
+				}
+
+				matches, err := filepath.Glob(pattern)
+
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+
+				for _, match := range matches {
+
+					if err := c.parseFile(match, includeDir, current, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+
+			// the rest of the block continues after the included blocks
+			c.Blocks = append(c.Blocks, Block{Conditions: current})
+
+		default:
+
+			block := &c.Blocks[len(c.Blocks)-1]
+			block.Options = append(block.Options, Option{Key: key, Values: args})
+		}
+	}
+
+	return scanner.Err()
+}
+
+// splitConfigLine splits a line into it's lower case keyword and arguments,
+// handling 'Key=Value' and double quoted arguments
+func splitConfigLine(line string) (string, []string, error) {
+
+	line = strings.TrimSpace(line)
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+
+	if end == -1 {
+		return strings.ToLower(line), nil, nil
+	}
+
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+
+	args := make([]string, 0, 1)
+
+	var arg strings.Builder
+	inQuote := false
+	hasArg := false
+
+	for _, r := range rest {
+
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			hasArg = true
+
+		case !inQuote && (r == ' ' || r == '\t'):
+			if hasArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				hasArg = false
+			}
+
+		case !inQuote && r == '#' && !hasArg:
+			return key, args, nil
+
+		default:
+			arg.WriteRune(r)
+			hasArg = true
+		}
+	}
+
+	if inQuote {
+		return "", nil, fmt.Errorf("unterminated quote: %s", line)
+	}
+
+	if hasArg {
+		args = append(args, arg.String())
+	}
+
+	return key, args, nil
+}
+
+func parseMatch(args []string) ([]MatchCriteria, error) {
+
+	criteria := make([]MatchCriteria, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+
+		m := MatchCriteria{Keyword: strings.ToLower(args[i])}
+
+		if strings.HasPrefix(m.Keyword, "!") {
+			m.Negate = true
+			m.Keyword = m.Keyword[1:]
+		}
+
+		switch m.Keyword {
+		case "all", "canonical", "final":
+
+		case "host", "originalhost", "user", "localuser", "exec", "localnetwork", "tagged":
+
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("Match %s requires an argument", m.Keyword)
+			}
+			i++
+			m.Arg = args[i]
+
+		default:
+			return nil, fmt.Errorf("unsupported Match criteria: %s", m.Keyword)
+		}
+
+		criteria = append(criteria, m)
+	}
+
+	return criteria, nil
+}
+
+// Hosts returns every literal host name from the Host lines, ignoring patterns
+func (c *SSHConfig) Hosts() []string {
+
+	hosts := make([]string, 0)
+
+	for _, block := range c.Blocks {
+
+		if len(block.Conditions) == 0 {
 			continue
 		}
 
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
+		cond := block.Conditions[len(block.Conditions)-1]
+
+		for _, host := range cond.Host {
+
+			if strings.ContainsAny(host, "*?!") || slices.Contains(hosts, host) {
+				continue
+			}
+
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+// resolveContext is the state used to evaluate conditions while resolving a host
+type resolveContext struct {
+	alias     string
+	localUser string
+	options   map[string][]string
+}
+
+func (r *resolveContext) get(key string) string {
+	if v, ok := r.options[key]; ok && len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (r *resolveContext) hostname() string {
+	if h := r.get("hostname"); h != "" {
+		return strings.ReplaceAll(h, "%h", r.alias)
+	}
+	return r.alias
+}
+
+func (r *resolveContext) user() string {
+	if u := r.get("user"); u != "" {
+		return u
+	}
+	return r.localUser
+}
+
+// Resolve computes the effective settings for alias the same way OpenSSH does.
+// For each option the first value obtained wins, so more specific blocks should come first in the file.
+func (c *SSHConfig) Resolve(alias string) Section {
+
+	ctx := resolveContext{
+		alias:   alias,
+		options: map[string][]string{},
+	}
+
+	if usr, err := user.Current(); err == nil {
+		ctx.localUser = usr.Username
+	}
+
+	for _, block := range c.Blocks {
+
+		if !ctx.matches(block.Conditions) {
 			continue
 		}
 
-		key := strings.ToLower(parts[0])
-		val := parts[1]
+		for _, opt := range block.Options {
 
-		switch key {
+			if cumulativeOptions[opt.Key] {
+				ctx.options[opt.Key] = append(ctx.options[opt.Key], opt.Values...)
+				continue
+			}
+
+			if _, ok := ctx.options[opt.Key]; !ok {
+				ctx.options[opt.Key] = opt.Values
+			}
+		}
+	}
+
+	section := Section{
+		Name:                  alias,
+		Hostname:              ctx.hostname(),
+		Port:                  DefaultPort,
+		User:                  ctx.user(),
+		ProxyJump:             ctx.get("proxyjump"),
+		StrictHostKeyChecking: ctx.get("stricthostkeychecking"),
+	}
+
+	if p := ctx.get("port"); p != "" {
+
+		if port, err := strconv.Atoi(p); err == nil {
+			section.Port = port
+		} else {
+			log.Warn().Err(err).Str("alias", alias).Str("port", p).Msg("Invalid port in ssh config")
+		}
+	}
+
+	if ids := ctx.options["identityfile"]; len(ids) > 0 {
+		section.IdentityFile = ctx.expandTokens(ids[0], section)
+	}
+
+	for _, path := range ctx.options["userknownhostsfile"] {
+		section.UserKnownHostsFile = append(section.UserKnownHostsFile, ctx.expandTokens(path, section))
+	}
+
+	for _, path := range ctx.options["globalknownhostsfile"] {
+		section.GlobalKnownHostsFile = append(section.GlobalKnownHostsFile, ctx.expandTokens(path, section))
+	}
+
+	log.Debug().
+		Str("alias", alias).
+		Str("host", section.Hostname).
+		Int("port", section.Port).
+		Str("user", section.User).
+		Str("key", section.IdentityFile).
+		Str("jump", section.ProxyJump).
+		Msg("Resolved ssh config")
+
+	return section
+}
+
+// expandTokens expands the path tokens supported by OpenSSH for IdentityFile and the known hosts files
+func (r *resolveContext) expandTokens(path string, section Section) string {
+
+	if !strings.Contains(path, "%") {
+		return ExpandPath(path)
+	}
+
+	home := ExpandPath("~")
+
+	var b strings.Builder
+
+	for i := 0; i < len(path); i++ {
+
+		if path[i] != '%' || i+1 >= len(path) {
+			b.WriteByte(path[i])
+			continue
+		}
+
+		i++
+
+		switch path[i] {
+		case '%':
+			b.WriteByte('%')
+		case 'd':
+			b.WriteString(home)
+		case 'h':
+			b.WriteString(section.Hostname)
+		case 'n':
+			b.WriteString(r.alias)
+		case 'p':
+			b.WriteString(strconv.Itoa(section.Port))
+		case 'r':
+			b.WriteString(section.User)
+		case 'u':
+			b.WriteString(r.localUser)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(path[i])
+		}
+	}
+
+	return ExpandPath(b.String())
+}
+
+func (r *resolveContext) matches(conditions []Condition) bool {
+
+	for _, cond := range conditions {
+
+		if cond.IsMatch {
+
+			if !r.matchCriteria(cond.Match) {
+				return false
+			}
+
+		} else if !matchPatternList(cond.Host, r.alias) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *resolveContext) matchCriteria(criteria []MatchCriteria) bool {
+
+	for _, m := range criteria {
+
+		var ok bool
+
+		switch m.Keyword {
+		case "all", "final":
+			ok = true
+		case "canonical", "localnetwork", "tagged":
+			ok = false
 		case "host":
+			ok = matchPatternList(strings.Split(m.Arg, ","), r.hostname())
+		case "originalhost":
+			ok = matchPatternList(strings.Split(m.Arg, ","), r.alias)
+		case "user":
+			ok = matchPatternList(strings.Split(m.Arg, ","), r.user())
+		case "localuser":
+			ok = matchPatternList(strings.Split(m.Arg, ","), r.localUser)
+		case "exec":
+			ok = r.matchExec(m.Arg)
+		}
 
-			current = nil
+		if ok == m.Negate {
+			return false
+		}
+	}
 
-			for _, name := range parts[1:] {
+	return true
+}
+
+func (r *resolveContext) matchExec(command string) bool {
+
+	command = strings.NewReplacer(
+		"%%", "%",
+		"%h", r.hostname(),
+		"%n", r.alias,
+		"%r", r.user(),
+		"%u", r.localUser,
+	).Replace(command)
+
+	log.Debug().Str("cmd", command).Msg("Running ssh config Match exec")
+
+	return exec.Command("sh", "-c", command).Run() == nil
+}
+
+// MatchPattern matches s against a single ssh pattern, ignoring case
+func MatchPattern(pattern, s string) bool {
+	return matchPattern(strings.ToLower(pattern), strings.ToLower(s))
+}
+
+// matchPatternList matches s against ssh patterns, it matches if any pattern matches and no negated pattern matches
+func matchPatternList(patterns []string, s string) bool {
+
+	matched := false
+
+	for _, pattern := range patterns {
 
-				cfg.Sections = append(cfg.Sections, Section{Name: name})
+		pattern = strings.TrimSpace(pattern)
 
-				curPtr := &cfg.Sections[len(cfg.Sections)-1]
-				current = append(current, curPtr)
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+
+			if matchPattern(strings.ToLower(negated), strings.ToLower(s)) {
+				return false
 			}
 
-		case "hostname":
-			for _, s := range current {
-				s.Hostname = val
+		} else if matchPattern(strings.ToLower(pattern), strings.ToLower(s)) {
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// matchPattern matches s against a pattern where '*' matches zero or more characters and '?' matches exactly one
+func matchPattern(pattern, s string) bool {
+
+	for len(pattern) > 0 {
+
+		switch pattern[0] {
+		case '*':
+
+			pattern = pattern[1:]
+
+			if len(pattern) == 0 {
+				return true
 			}
 
-		case "port":
-			if p, err := strconv.Atoi(val); err != nil {
-				return nil, err
-			} else {
-				for _, s := range current {
-					s.Port = p
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(pattern, s[i:]) {
+					return true
 				}
 			}
+			return false
 
-		case "user":
-			for _, s := range current {
-				s.User = val
+		case '?':
+
+			if len(s) == 0 {
+				return false
 			}
 
-		case "identityfile":
-			for _, s := range current {
-				s.IdentityFile = ExpandPath(val)
+		default:
+
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
 			}
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		pattern = pattern[1:]
+		s = s[1:]
 	}
 
-	return &cfg, nil
+	return len(s) == 0
 }
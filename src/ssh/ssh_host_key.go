@@ -0,0 +1,258 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	ErrHostKeyMismatch = errors.New("REMOTE HOST IDENTIFICATION HAS CHANGED, someone could be doing something nasty")
+	ErrHostKeyRevoked  = errors.New("Remote host key is revoked")
+	ErrHostKeyUnknown  = errors.New("Remote host key is not known and strict host key checking is enabled")
+	ErrHostKeyRejected = errors.New("Remote host key was rejected by the user")
+)
+
+// HostKeyChecking mirrors the StrictHostKeyChecking option from ssh_config
+type HostKeyChecking int
+
+var (
+	HostKeyCheckingAsk       HostKeyChecking = 0
+	HostKeyCheckingStrict    HostKeyChecking = 1
+	HostKeyCheckingAcceptNew HostKeyChecking = 2
+	HostKeyCheckingOff       HostKeyChecking = 3
+	HostKeyCheckingInsecure  HostKeyChecking = 4
+)
+
+func (h HostKeyChecking) String() string {
+	switch h {
+	case HostKeyCheckingAsk:
+		return "ask"
+	case HostKeyCheckingStrict:
+		return "yes"
+	case HostKeyCheckingAcceptNew:
+		return "accept-new"
+	case HostKeyCheckingOff:
+		return "no"
+	case HostKeyCheckingInsecure:
+		return "insecure"
+	}
+	return ""
+}
+
+// ParseHostKeyChecking parses a StrictHostKeyChecking value, accepting the same values as OpenSSH
+func ParseHostKeyChecking(s string) (HostKeyChecking, error) {
+
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "ask":
+		return HostKeyCheckingAsk, nil
+	case "yes", "true":
+		return HostKeyCheckingStrict, nil
+	case "accept-new":
+		return HostKeyCheckingAcceptNew, nil
+	case "no", "off", "false":
+		return HostKeyCheckingOff, nil
+	}
+
+	return HostKeyCheckingAsk, fmt.Errorf("invalid StrictHostKeyChecking value: %s", s)
+}
+
+// KnownHostsFiles returns the user and global known_hosts files for the section,
+// using the OpenSSH defaults when the section does not set them
+func KnownHostsFiles(section Section) (user []string, global []string) {
+
+	user = section.UserKnownHostsFile
+	global = section.GlobalKnownHostsFile
+
+	if len(user) == 0 {
+		user = []string{ExpandPath("~/.ssh/known_hosts"), ExpandPath("~/.ssh/known_hosts2")}
+	}
+
+	if len(global) == 0 {
+		global = []string{"/etc/ssh/ssh_known_hosts", "/etc/ssh/ssh_known_hosts2"}
+	}
+
+	return user, global
+}
+
+// GetHostKeyCallback returns a host key callback which verifies against the known_hosts files of the section.
+// The returned algorithms should be used as the HostKeyAlgorithms of the client config for the given addr,
+// so that the server offers a key type we already know about.
+func GetHostKeyCallback(section Section, addr string, checking HostKeyChecking, canPrompt bool) (gossh.HostKeyCallback, []string, error) {
+
+	if checking == HostKeyCheckingInsecure {
+
+		return func(hostname string, _ net.Addr, _ gossh.PublicKey) error {
+			log.Warn().Str("host", hostname).Msg("Host key checking is disabled, not verifying remote host key")
+			return nil
+		}, nil, nil
+	}
+
+	userFiles, globalFiles := KnownHostsFiles(section)
+
+	files := make([]string, 0, len(userFiles)+len(globalFiles))
+
+	for _, path := range slices.Concat(userFiles, globalFiles) {
+
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+
+	log.Debug().Strs("files", files).Str("checking", checking.String()).Msg("Loading known hosts")
+
+	known, err := knownhosts.New(files...)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	callback := func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+
+		err := known(hostname, remote, key)
+
+		if err == nil {
+			log.Debug().Str("host", hostname).Msg("Host key is known")
+			return nil
+		}
+
+		var revokedErr *knownhosts.RevokedError
+		if errors.As(err, &revokedErr) {
+			return fmt.Errorf("%w: %s", ErrHostKeyRevoked, revokedErr.Revoked.String())
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		fingerprint := gossh.FingerprintSHA256(key)
+
+		if len(keyErr.Want) > 0 {
+
+			log.Error().
+				Str("host", hostname).
+				Str("type", key.Type()).
+				Str("fingerprint", fingerprint).
+				Str("known", keyErr.Want[0].String()).
+				Msg("Host key mismatch")
+
+			return fmt.Errorf("%w: %s key for %s is %s", ErrHostKeyMismatch, key.Type(), hostname, fingerprint)
+		}
+
+		switch checking {
+
+		case HostKeyCheckingStrict:
+			return fmt.Errorf("%w: %s key for %s is %s", ErrHostKeyUnknown, key.Type(), hostname, fingerprint)
+
+		case HostKeyCheckingAsk:
+
+			if !canPrompt {
+				return fmt.Errorf("%w: %s key for %s is %s", ErrHostKeyUnknown, key.Type(), hostname, fingerprint)
+			}
+
+			answer, err := PromptForLineF(
+				"The authenticity of host '%s' can't be established.\n"+
+					"%s key fingerprint is %s.\n"+
+					"Are you sure you want to continue connecting (yes/no)? ",
+				hostname, key.Type(), fingerprint)
+
+			if err != nil {
+				return err
+			}
+
+			if strings.ToLower(strings.TrimSpace(string(answer))) != "yes" {
+				return ErrHostKeyRejected
+			}
+		}
+
+		if len(userFiles) == 0 {
+			return nil
+		}
+
+		if err := addKnownHost(userFiles[0], hostname, key); err != nil {
+			log.Warn().Err(err).Str("file", userFiles[0]).Msg("Could not add host key to known hosts")
+		} else {
+			log.Info().Str("host", hostname).Str("file", userFiles[0]).Msg("Permanently added host key to known hosts")
+		}
+
+		return nil
+	}
+
+	return callback, hostKeyAlgorithms(known, addr), nil
+}
+
+func addKnownHost(path string, hostname string, key gossh.PublicKey) error {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+
+	return err
+}
+
+// hostKeyAlgorithms asks the known hosts callback which keys it has for addr.
+// Without this the server can negotiate a key type we have never seen, which knownhosts reports as a mismatch.
+func hostKeyAlgorithms(known gossh.HostKeyCallback, addr string) []string {
+
+	var keyErr *knownhosts.KeyError
+
+	err := known(addr, &net.TCPAddr{IP: net.IPv4zero}, probeKey{})
+
+	if !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+		return nil
+	}
+
+	algos := make([]string, 0, len(keyErr.Want))
+	seen := map[string]bool{}
+
+	for _, want := range keyErr.Want {
+
+		types := []string{want.Key.Type()}
+
+		if types[0] == gossh.KeyAlgoRSA {
+			types = []string{gossh.KeyAlgoRSASHA512, gossh.KeyAlgoRSASHA256, gossh.KeyAlgoRSA}
+		}
+
+		for _, t := range types {
+			if !seen[t] {
+				seen[t] = true
+				algos = append(algos, t)
+			}
+		}
+	}
+
+	return algos
+}
+
+// probeKey is a public key which never matches any known host
+type probeKey struct{}
+
+func (probeKey) Type() string {
+	return "mitosu-probe"
+}
+
+func (probeKey) Marshal() []byte {
+	return []byte("mitosu-probe")
+}
+
+func (probeKey) Verify([]byte, *gossh.Signature) error {
+	return errors.New("probe key cannot verify")
+}
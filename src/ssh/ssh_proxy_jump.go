@@ -0,0 +1,114 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ParseProxyJump parses a ProxyJump value, a comma separated list of [user@]host[:port] or ssh://[user@]host[:port].
+// The hops are returned in the order they are connected through, if a hop matches a Host in the config, it's settings are used.
+// A value of "none" returns no hops.
+func ParseProxyJump(spec string, config *SSHConfig) ([]Section, error) {
+
+	return parseProxyJump(spec, config, 0)
+}
+
+func parseProxyJump(spec string, config *SSHConfig, depth int) ([]Section, error) {
+
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("ProxyJump nested too deeply: %s", spec)
+	}
+
+	spec = strings.TrimSpace(spec)
+
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return nil, nil
+	}
+
+	hops := make([]Section, 0)
+
+	for _, hop := range strings.Split(spec, ",") {
+
+		hop = strings.TrimSpace(hop)
+
+		if hop == "" {
+			continue
+		}
+
+		hopUser, host, port, err := splitJumpHost(hop)
+
+		if err != nil {
+			return nil, err
+		}
+
+		section := Section{Name: host, Hostname: host, Port: DefaultPort}
+
+		if config != nil {
+			section = config.Resolve(host)
+		} else if usr, err := user.Current(); err == nil {
+			section.User = usr.Username
+		}
+
+		if hopUser != "" {
+			section.User = hopUser
+		}
+
+		if port != 0 {
+			section.Port = port
+		}
+
+		hops = append(hops, section)
+	}
+
+	// like OpenSSH, only the ProxyJump of the first hop is followed, the later hops are reached through the earlier ones
+	if len(hops) > 0 && hops[0].ProxyJump != "" && hops[0].ProxyJump != hops[0].Name {
+
+		first, err := parseProxyJump(hops[0].ProxyJump, config, depth+1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		hops = append(first, hops...)
+	}
+
+	return hops, nil
+}
+
+func splitJumpHost(hop string) (string, string, int, error) {
+
+	if !strings.HasPrefix(hop, "ssh://") {
+		hop = "ssh://" + hop
+	}
+
+	u, err := url.Parse(hop)
+
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid jump host %s: %w", hop, err)
+	}
+
+	host := u.Hostname()
+
+	if host == "" {
+		return "", "", 0, fmt.Errorf("invalid jump host %s: missing host", hop)
+	}
+
+	port := 0
+
+	if p := u.Port(); p != "" {
+
+		if port, err = strconv.Atoi(p); err != nil {
+			return "", "", 0, fmt.Errorf("invalid jump host port %s: %w", hop, err)
+		}
+	}
+
+	return u.User.Username(), host, port, nil
+}
+
+func sectionAddr(section Section) string {
+	return net.JoinHostPort(section.Hostname, strconv.Itoa(section.Port))
+}
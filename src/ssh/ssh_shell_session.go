@@ -0,0 +1,218 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mitosu/src/shell"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// shellTimeout is how long a batch of commands can take in a kept shell before the shell is considered dead
+	shellTimeout = 2 * time.Minute
+)
+
+var (
+	ErrShellTimeout = errors.New("Timed out waiting for the remote shell")
+)
+
+// shellSession is a long lived remote shell, commands are written to it's stdin in batches
+// and the output of each command is split using the separator printed after it
+type shellSession struct {
+	session  *gossh.Session
+	stdin    io.WriteCloser
+	stdout   *bufio.Reader
+	stderr   *syncBuffer
+	sep      string
+	withRoot bool
+	shType   shell.ShellType
+}
+
+// runCommandsInShell runs the commands in the kept shell, starting it if needed.
+// If the shell has died it is restarted and the commands are tried once more.
+func (s *SSHClient) runCommandsInShell(withRoot bool, sh shell.Shell, commands []shell.ShellCmd) ([]string, error) {
+
+	s.keptShellMu.Lock()
+	defer s.keptShellMu.Unlock()
+
+	var err error
+
+	for attempt := 0; attempt < 2; attempt++ {
+
+		if s.keptShell != nil && (s.keptShell.withRoot != withRoot || s.keptShell.shType != sh.GetType()) {
+			s.closeShell()
+		}
+
+		if s.keptShell == nil {
+
+			if s.keptShell, err = s.newShellSession(withRoot, sh); err != nil {
+				return nil, err
+			}
+		}
+
+		var results []string
+
+		if results, err = s.keptShell.run(sh, commands); err == nil {
+			return results, nil
+		}
+
+		log.Debug().Err(err).Str("host", s.Config.Hostname).Int("attempt", attempt).Msg("Kept shell died, restarting")
+
+		s.closeShell()
+	}
+
+	return nil, err
+}
+
+func (s *SSHClient) newShellSession(withRoot bool, sh shell.Shell) (*shellSession, error) {
+
+	session, err := s.Client.NewSession()
+
+	if err != nil {
+		return nil, err
+	}
+
+	stdin, err := session.StdinPipe()
+
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	stdout, err := session.StdoutPipe()
+
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	stderr := &syncBuffer{}
+	session.Stderr = stderr
+
+	if err := s.startShell(session, stdin, withRoot, sh); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	log.Debug().Str("host", s.Config.Hostname).Bool("root", withRoot).Msg("Started kept shell")
+
+	return &shellSession{
+		session:  session,
+		stdin:    stdin,
+		stdout:   bufio.NewReader(stdout),
+		stderr:   stderr,
+		sep:      shell.NewSeparator(),
+		withRoot: withRoot,
+		shType:   sh.GetType(),
+	}, nil
+}
+
+func (s *SSHClient) closeShell() {
+
+	if s.keptShell != nil {
+		s.keptShell.close()
+		s.keptShell = nil
+	}
+}
+
+func (k *shellSession) run(sh shell.Shell, commands []shell.ShellCmd) ([]string, error) {
+
+	log.Debug().
+		Int("shell", int(sh.GetType())).
+		Interface("command", commands).
+		Msg("Running command in kept shell")
+
+	// if the shell hangs, closing the session unblocks the read below
+	timer := time.AfterFunc(shellTimeout, func() {
+		log.Warn().Dur("timeout", shellTimeout).Msg("Remote shell did not respond, closing it")
+		k.session.Close()
+	})
+	defer timer.Stop()
+
+	// commands must not read our stdin, or they would eat the commands after them
+	noStdin := make([]shell.ShellCmd, len(commands))
+
+	for i, cmd := range commands {
+		noStdin[i] = cmd
+		noStdin[i].Cmd = sh.NoStdin(cmd.Cmd)
+	}
+
+	if err := shell.WriteCommands(k.stdin, sh, k.sep, noStdin); err != nil {
+		return nil, err
+	}
+
+	results := make([]string, 0, len(commands))
+
+	var out strings.Builder
+
+	for len(results) < len(commands) {
+
+		line, err := k.stdout.ReadString('\n')
+
+		if err != nil {
+
+			if !timer.Stop() {
+				return nil, ErrShellTimeout
+			}
+
+			return nil, fmt.Errorf("remote shell exited: %w: %s", err, k.stderr.String())
+		}
+
+		if before, ok := strings.CutSuffix(line, k.sep); ok {
+
+			out.WriteString(before)
+			results = append(results, out.String())
+			out.Reset()
+
+			continue
+		}
+
+		out.WriteString(line)
+	}
+
+	if stderr := k.stderr.Reset(); stderr != "" {
+		log.Debug().Str("stderr", stderr).Msg("Got kept shell stderr")
+	}
+
+	return results, nil
+}
+
+func (k *shellSession) close() {
+	k.stdin.Close()
+	k.session.Close()
+}
+
+// syncBuffer is a buffer which can be written by the ssh session while it is read from another goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Reset clears the buffer returning what it contained
+func (b *syncBuffer) Reset() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.buf.String()
+	b.buf.Reset()
+	return s
+}
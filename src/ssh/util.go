@@ -21,3 +21,14 @@ func ExpandPath(path string) string {
 
 	return path
 }
+
+func expandPaths(paths []string) []string {
+
+	expanded := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		expanded = append(expanded, ExpandPath(path))
+	}
+
+	return expanded
+}